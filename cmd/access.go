@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"main/internal/model"
+	"main/internal/storage"
+	"slices"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const accessDeniedText = "Бот доступен только по приглашению. Попросите у администратора код и отправьте /start <код>."
+
+func (a *app) isAdmin(userID int64) bool {
+	return slices.Contains(a.cfg().AdminIDs, userID)
+}
+
+// isAllowed проверяет доступ пользователя в чате: администраторы, пользователи из списка доступа
+// и все участники разрешенных групп
+func (a *app) isAllowed(userID, chatID int64) bool {
+	if !a.cfg().AccessControl || a.isAdmin(userID) {
+		return true
+	}
+	allowed, err := a.repo.IsAllowed(model.AccessSubjectUser, userID)
+	if err != nil {
+		log.Printf("Error checking access for user %d: %v", userID, err)
+		return false
+	}
+	if allowed || chatID == userID {
+		return allowed
+	}
+	allowed, err = a.repo.IsAllowed(model.AccessSubjectChat, chatID)
+	if err != nil {
+		log.Printf("Error checking access for chat %d: %v", chatID, err)
+		return false
+	}
+	return allowed
+}
+
+// authorizeMessage пропускает сообщение к обработчикам, если у отправителя есть доступ.
+// Сообщение /start <код> без доступа активирует приглашение. Заблокированным пользователям бот не отвечает.
+func (a *app) authorizeMessage(message *tgbotapi.Message) bool {
+	if message.From == nil {
+		return false
+	}
+	if a.isBanned(message.From.ID) {
+		log.Printf("Ignoring message from banned user %d (%s)", message.From.ID, message.From.UserName)
+		return false
+	}
+	if a.isAllowed(message.From.ID, message.Chat.ID) {
+		return true
+	}
+
+	if message.IsCommand() && message.Command() == "start" && message.CommandArguments() != "" {
+		a.redeemInvite(message)
+		return false
+	}
+	log.Printf("Access denied for user %d (%s) in chat %d", message.From.ID, message.From.UserName, message.Chat.ID)
+	// В группах отвечаем только на команды, чтобы не отвечать на каждое сообщение участников
+	if message.Chat.IsPrivate() || message.IsCommand() {
+		msg := tgbotapi.NewMessage(message.Chat.ID, accessDeniedText)
+		msg.ReplyToMessageID = message.MessageID
+		a.bot.Send(msg)
+	}
+	return false
+}
+
+// authorizeCallback проверяет доступ для нажатия inline-кнопки
+func (a *app) authorizeCallback(query *tgbotapi.CallbackQuery) bool {
+	chatID := query.From.ID
+	if query.Message != nil {
+		chatID = query.Message.Chat.ID
+	}
+	if !a.isBanned(query.From.ID) && a.isAllowed(query.From.ID, chatID) {
+		return true
+	}
+	answerCallback(a.bot, query, "Нет доступа.")
+	return false
+}
+
+func (a *app) redeemInvite(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	err := a.repo.RedeemInvite(message.CommandArguments(), message.From.ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		a.bot.Send(tgbotapi.NewMessage(chatID, "Код приглашения недействителен: он уже использован, истек или введен с ошибкой."))
+		return
+	}
+	if err != nil {
+		log.Printf("Error redeeming invite for user %d: %v", message.From.ID, err)
+		a.bot.Send(tgbotapi.NewMessage(chatID, "Не удалось активировать приглашение, попробуйте позже."))
+		return
+	}
+	log.Printf("User %d (%s) redeemed an invite", message.From.ID, message.From.UserName)
+	a.rememberUser(message.From)
+	a.bot.Send(tgbotapi.NewMessage(chatID, "Приглашение принято, добро пожаловать!"))
+	sendMainMenu(a.bot, chatID)
+}
+
+// handleInviteCommand выдает администратору одноразовый код приглашения
+func (a *app) handleInviteCommand(message *tgbotapi.Message) {
+	if !a.requireAdmin(message) {
+		return
+	}
+	code, err := newInviteCode()
+	if err != nil {
+		log.Printf("Error generating invite code: %v", err)
+		a.bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Не удалось создать приглашение."))
+		return
+	}
+	invite := &model.Invite{
+		Code:      code,
+		CreatedBy: message.From.ID,
+		ExpiresAt: time.Now().Add(a.cfg().InviteTTL),
+	}
+	if err := a.repo.CreateInvite(invite); err != nil {
+		log.Printf("Error saving invite: %v", err)
+		a.bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Не удалось создать приглашение."))
+		return
+	}
+
+	text := fmt.Sprintf("Одноразовый код приглашения (действует до %s):\n/start %s\n\nСсылка: https://t.me/%s?start=%s",
+		invite.ExpiresAt.Format("02.01.2006 15:04"), code, a.bot.Self.UserName, code)
+	a.bot.Send(tgbotapi.NewMessage(message.Chat.ID, text))
+}
+
+// handleChatAccessCommand разрешает (/allowchat) или запрещает (/denychat) бота всем участникам текущей группы
+func (a *app) handleChatAccessCommand(message *tgbotapi.Message, allow bool) {
+	if !a.requireAdmin(message) {
+		return
+	}
+	chatID := message.Chat.ID
+	if message.Chat.IsPrivate() {
+		a.bot.Send(tgbotapi.NewMessage(chatID, "Команда выполняется в группе, доступ к которой нужно изменить."))
+		return
+	}
+
+	var err error
+	text := "Бот доступен всем участникам этой группы."
+	if allow {
+		err = a.repo.Allow(model.AccessSubjectChat, chatID, message.From.ID)
+	} else {
+		err = a.repo.Disallow(model.AccessSubjectChat, chatID)
+		text = "Доступ для участников группы отключен: ботом пользуются только приглашенные пользователи."
+	}
+	if err != nil {
+		log.Printf("Error changing access for chat %d: %v", chatID, err)
+		text = "Не удалось изменить доступ для группы."
+	}
+	a.bot.Send(tgbotapi.NewMessage(chatID, text))
+}
+
+// requireAdmin проверяет, что команду отправил администратор, иначе отвечает отказом
+func (a *app) requireAdmin(message *tgbotapi.Message) bool {
+	if a.isAdmin(message.From.ID) {
+		return true
+	}
+	msg := tgbotapi.NewMessage(message.Chat.ID, "Команда доступна только администраторам.")
+	msg.ReplyToMessageID = message.MessageID
+	a.bot.Send(msg)
+	return false
+}
+
+// newInviteCode 16 случайных hex-символов: подходит для параметра deep link ?start=
+func newInviteCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"main/internal/config"
+	"main/internal/model"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// Сколько последних активных пользователей показывать в /users
+	usersListLimit = 50
+	// Сколько задач показывать в /jobs
+	jobsListLimit = 30
+)
+
+// Настройки, которые читаются только при запуске: /reload их не меняет, а сообщает, что нужен перезапуск
+var startupSettings = []string{
+	"TELEGRAM_BOT_TOKEN", "BOTHUB_API_TOKEN", "APP_ADDR", "APP_DEBUG",
+	"DB_URI", "DB_HOST", "DB_PORT", "DB_USER", "DB_PASSWORD", "DB_NAME",
+	"STT_PROVIDER", "STT_API_URL", "STT_API_TOKEN", "STT_MODEL", "STT_LANGUAGE",
+	"STT_LOCAL_COMMAND", "STT_LOCAL_ARGS", "STT_LOCAL_MODEL", "STT_MAX_UPLOAD_BYTES",
+	"STT_CHUNK_SECONDS", "STT_CHUNK_OVERLAP_SECONDS", "STT_CHUNK_SEARCH_SECONDS", "STT_CHUNK_WORKERS",
+	"SUMMARY_MAX_INPUT_TOKENS", "SUMMARY_WORKERS", "PROMPTS_DIR", "PROMPT_PRESET", "QA_HISTORY_TOKENS",
+	"CHAT_MODEL", "ALLOWED_HOSTS", "UPDATES_MODE", "WEBHOOK_URL", "WEBHOOK_PATH", "WEBHOOK_SECRET",
+	"SHUTDOWN_TIMEOUT", "QUEUE_WORKERS",
+}
+
+// isBanned проверяет блокировку пользователя; администраторов заблокировать нельзя
+func (a *app) isBanned(userID int64) bool {
+	if a.isAdmin(userID) {
+		return false
+	}
+	banned, err := a.repo.IsBanned(userID)
+	if err != nil {
+		log.Printf("Error checking ban for user %d: %v", userID, err)
+		return false
+	}
+	return banned
+}
+
+// jobStats сводка по задачам за сутки и текущей очереди для /stats
+func (a *app) jobStats() (string, error) {
+	counts, err := a.repo.CountJobsByStatus(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		return "", err
+	}
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	queued, err := a.repo.ListJobsByStatus(model.JobStatusQueued)
+	if err != nil {
+		return "", err
+	}
+	running, err := a.repo.ListJobsByStatus(model.JobActiveStatuses...)
+	if err != nil {
+		return "", err
+	}
+	users, err := a.repo.ListUsers()
+	if err != nil {
+		return "", err
+	}
+	bans, err := a.repo.ListBans()
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{
+		fmt.Sprintf("Задачи за сутки: %d, готово %d, с ошибкой %d, отменено %d",
+			total, counts[model.JobStatusDone], counts[model.JobStatusFailed], counts[model.JobStatusCancelled]),
+		fmt.Sprintf("Очередь: ждут %d, выполняются %d (воркеров %d)", len(queued), len(running), a.cfg().QueueWorkers),
+		fmt.Sprintf("Пользователей: %d, заблокировано %d", len(users), len(bans)),
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// handleUsersCommand список пользователей бота, последние активные сверху
+func (a *app) handleUsersCommand(message *tgbotapi.Message) {
+	if !a.requireAdmin(message) {
+		return
+	}
+	chatID := message.Chat.ID
+	users, err := a.repo.ListUsers()
+	if err == nil {
+		var bans []model.Ban
+		bans, err = a.repo.ListBans()
+		if err == nil {
+			sendOrEditMessage(a.bot, chatID, 0, a.usersList(users, bans), message.MessageID)
+			return
+		}
+	}
+	log.Printf("Error listing users: %v", err)
+	a.bot.Send(tgbotapi.NewMessage(chatID, "Не удалось получить список пользователей."))
+}
+
+func (a *app) usersList(users []model.User, bans []model.Ban) string {
+	if len(users) == 0 {
+		return "Пользователей пока нет."
+	}
+	slices.SortFunc(users, func(x, y model.User) int { return y.LastSeen.Compare(x.LastSeen) })
+	header := fmt.Sprintf("Пользователей: %d", len(users))
+	if len(users) > usersListLimit {
+		header += fmt.Sprintf(", показаны %d последних активных", usersListLimit)
+		users = users[:usersListLimit]
+	}
+
+	lines := []string{header + ":"}
+	for _, user := range users {
+		line := strconv.FormatInt(user.ID, 10)
+		if user.UserName != "" {
+			line += " @" + user.UserName
+		}
+		if name := strings.TrimSpace(user.FirstName + " " + user.LastName); name != "" {
+			line += " " + name
+		}
+		line += ", был " + user.LastSeen.Format("02.01.2006 15:04")
+		if a.isAdmin(user.ID) {
+			line += " [админ]"
+		}
+		if slices.ContainsFunc(bans, func(ban model.Ban) bool { return ban.UserID == user.ID }) {
+			line += " [заблокирован]"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// handleBanCommand блокирует (/ban <id> [причина]) или разблокирует (/unban <id>) пользователя.
+// При блокировке его незавершенные задачи отменяются.
+func (a *app) handleBanCommand(message *tgbotapi.Message, ban bool) {
+	if !a.requireAdmin(message) {
+		return
+	}
+	chatID := message.Chat.ID
+	idArg, reason, _ := strings.Cut(strings.TrimSpace(message.CommandArguments()), " ")
+	userID, err := strconv.ParseInt(idArg, 10, 64)
+	if err != nil {
+		a.bot.Send(tgbotapi.NewMessage(chatID, "Использование: /ban <id> [причина] или /unban <id>."))
+		return
+	}
+
+	if !ban {
+		unbanned, err := a.repo.Unban(userID)
+		text := fmt.Sprintf("Пользователь %s разблокирован.", a.userLabel(userID))
+		switch {
+		case err != nil:
+			log.Printf("Error unbanning user %d: %v", userID, err)
+			text = "Не удалось разблокировать пользователя."
+		case !unbanned:
+			text = "Пользователь не был заблокирован."
+		default:
+			log.Printf("Admin %d unbanned user %d", message.From.ID, userID)
+		}
+		a.bot.Send(tgbotapi.NewMessage(chatID, text))
+		return
+	}
+
+	if a.isAdmin(userID) {
+		a.bot.Send(tgbotapi.NewMessage(chatID, "Администратора заблокировать нельзя."))
+		return
+	}
+	if err := a.repo.Ban(&model.Ban{UserID: userID, BannedBy: message.From.ID, Reason: strings.TrimSpace(reason)}); err != nil {
+		log.Printf("Error banning user %d: %v", userID, err)
+		a.bot.Send(tgbotapi.NewMessage(chatID, "Не удалось заблокировать пользователя."))
+		return
+	}
+	log.Printf("Admin %d banned user %d: %s", message.From.ID, userID, reason)
+	text := fmt.Sprintf("Пользователь %s заблокирован.", a.userLabel(userID))
+	if cancelled := a.cancelUserJobs(userID); cancelled > 0 {
+		text += fmt.Sprintf(" Отменено задач: %d.", cancelled)
+	}
+	a.bot.Send(tgbotapi.NewMessage(chatID, text))
+}
+
+// cancelUserJobs отменяет все незавершенные задачи пользователя во всех чатах
+func (a *app) cancelUserJobs(userID int64) int {
+	jobs, err := a.repo.ListJobsByStatus(model.JobPendingStatuses...)
+	if err != nil {
+		log.Printf("Error listing jobs of user %d: %v", userID, err)
+		return 0
+	}
+	count := 0
+	for _, job := range jobs {
+		if job.UserID != userID {
+			continue
+		}
+		cancelled, err := a.cancelJob(job.ID)
+		if err != nil {
+			log.Printf("Error cancelling job %d: %v", job.ID, err)
+			continue
+		}
+		if cancelled {
+			count++
+		}
+	}
+	return count
+}
+
+// handleBroadcastCommand рассылает текст во все известные боту чаты, кроме чатов заблокированных пользователей.
+// Сообщения отправляются с паузой BROADCAST_INTERVAL в фоне; по окончании администратор получает отчет.
+// Остановка бота ждет рассылку до SHUTDOWN_TIMEOUT, затем прерывает ее.
+func (a *app) handleBroadcastCommand(ctx context.Context, message *tgbotapi.Message) {
+	if !a.requireAdmin(message) {
+		return
+	}
+	chatID := message.Chat.ID
+	text := strings.TrimSpace(message.CommandArguments())
+	if text == "" {
+		a.bot.Send(tgbotapi.NewMessage(chatID, "Использование: /broadcast <текст сообщения>."))
+		return
+	}
+	chatIDs, err := a.repo.ListChatIDs()
+	if err != nil {
+		log.Printf("Error listing chats for broadcast: %v", err)
+		a.bot.Send(tgbotapi.NewMessage(chatID, "Не удалось получить список чатов."))
+		return
+	}
+	chatIDs = slices.DeleteFunc(chatIDs, a.isBanned)
+	if !a.broadcasting.CompareAndSwap(false, true) {
+		a.bot.Send(tgbotapi.NewMessage(chatID, "Предыдущая рассылка еще не завершена."))
+		return
+	}
+
+	log.Printf("Admin %d started broadcast to %d chats", message.From.ID, len(chatIDs))
+	a.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Рассылка в %d чатов начата.", len(chatIDs))))
+	a.background.Add(1)
+	go func() {
+		defer a.background.Done()
+		defer a.broadcasting.Store(false)
+		sent, failed := a.broadcast(ctx, chatIDs, text)
+		log.Printf("Broadcast finished: %d sent, %d failed", sent, failed)
+		report := fmt.Sprintf("Рассылка завершена: доставлено %d, не доставлено %d.", sent, failed)
+		if ctx.Err() != nil {
+			report = fmt.Sprintf("Рассылка прервана остановкой бота: доставлено %d, не доставлено %d.", sent, failed)
+		}
+		a.bot.Send(tgbotapi.NewMessage(chatID, report))
+	}()
+}
+
+func (a *app) broadcast(ctx context.Context, chatIDs []int64, text string) (sent, failed int) {
+	ticker := time.NewTicker(max(a.cfg().BroadcastInterval, time.Millisecond))
+	defer ticker.Stop()
+	for _, chatID := range chatIDs {
+		select {
+		case <-ctx.Done():
+			return sent, failed
+		case <-ticker.C:
+		}
+		if err := a.sendBroadcast(ctx, chatID, text); err != nil {
+			// Чаще всего пользователь заблокировал бота или бота удалили из группы
+			log.Printf("Broadcast to chat %d failed: %v", chatID, err)
+			failed++
+			continue
+		}
+		sent++
+	}
+	return sent, failed
+}
+
+// sendBroadcast отправляет сообщение рассылки; если Telegram просит подождать (429), повторяет один раз
+func (a *app) sendBroadcast(ctx context.Context, chatID int64, text string) error {
+	for attempt := 0; ; attempt++ {
+		_, err := a.bot.Send(tgbotapi.NewMessage(chatID, text))
+		var tgErr *tgbotapi.Error
+		if err == nil || attempt > 0 || !errors.As(err, &tgErr) || tgErr.RetryAfter == 0 {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(tgErr.RetryAfter) * time.Second):
+		}
+	}
+}
+
+// handleJobsCommand показывает незавершенные задачи (/jobs), одну задачу (/jobs <id>) или отменяет ее (/jobs kill <id>)
+func (a *app) handleJobsCommand(message *tgbotapi.Message) {
+	if !a.requireAdmin(message) {
+		return
+	}
+	chatID := message.Chat.ID
+	args := strings.Fields(message.CommandArguments())
+	usage := "Использование: /jobs, /jobs <id> или /jobs kill <id>."
+
+	switch {
+	case len(args) == 0:
+		jobs, err := a.repo.ListJobsByStatus(model.JobPendingStatuses...)
+		if err != nil {
+			log.Printf("Error listing jobs: %v", err)
+			a.bot.Send(tgbotapi.NewMessage(chatID, "Не удалось получить список задач."))
+			return
+		}
+		sendOrEditMessage(a.bot, chatID, 0, jobsList(jobs), message.MessageID)
+	case len(args) == 1:
+		jobID, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			a.bot.Send(tgbotapi.NewMessage(chatID, usage))
+			return
+		}
+		job, err := a.repo.GetJob(jobID)
+		if err != nil {
+			log.Printf("Error loading job %d: %v", jobID, err)
+			a.bot.Send(tgbotapi.NewMessage(chatID, "Задача не найдена."))
+			return
+		}
+		sendOrEditMessage(a.bot, chatID, 0, a.jobDetails(job), message.MessageID)
+	case len(args) == 2 && args[0] == "kill":
+		jobID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			a.bot.Send(tgbotapi.NewMessage(chatID, usage))
+			return
+		}
+		cancelled, err := a.cancelJob(jobID)
+		text := fmt.Sprintf("Задача %d отменяется.", jobID)
+		switch {
+		case err != nil:
+			log.Printf("Error cancelling job %d: %v", jobID, err)
+			text = "Не удалось отменить задачу."
+		case !cancelled:
+			text = "Задача уже завершена."
+		default:
+			log.Printf("Admin %d cancelled job %d", message.From.ID, jobID)
+		}
+		a.bot.Send(tgbotapi.NewMessage(chatID, text))
+	default:
+		a.bot.Send(tgbotapi.NewMessage(chatID, usage))
+	}
+}
+
+func jobsList(jobs []model.Job) string {
+	if len(jobs) == 0 {
+		return "Незавершенных задач нет."
+	}
+	header := fmt.Sprintf("Незавершенных задач: %d", len(jobs))
+	if len(jobs) > jobsListLimit {
+		header += fmt.Sprintf(", показаны первые %d", jobsListLimit)
+		jobs = jobs[:jobsListLimit]
+	}
+	lines := []string{header + ":"}
+	for _, job := range jobs {
+		lines = append(lines, fmt.Sprintf("%d %s, пользователь %d, %s назад: %s",
+			job.ID, job.Status, job.UserID, time.Since(job.CreatedAt).Round(time.Second), job.Source))
+	}
+	return strings.Join(lines, "\n") + "\n\nОтменить задачу: /jobs kill <id>."
+}
+
+func (a *app) jobDetails(job *model.Job) string {
+	lines := []string{
+		fmt.Sprintf("Задача %d (%s): %s", job.ID, job.Kind, job.Status),
+		"Пользователь: " + a.userLabel(job.UserID),
+		fmt.Sprintf("Чат: %d", job.ChatID),
+		"Источник: " + job.Source,
+		"Создана: " + job.CreatedAt.Format("02.01.2006 15:04:05"),
+		"Обновлена: " + job.UpdatedAt.Format("02.01.2006 15:04:05"),
+	}
+	if job.BatchID != 0 {
+		lines = append(lines, fmt.Sprintf("Плейлист: %d", job.BatchID))
+	}
+	if job.CancelRequested {
+		lines = append(lines, "Запрошена отмена")
+	}
+	if job.Error != "" {
+		lines = append(lines, "Ошибка: "+job.Error)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// handleReloadCommand перечитывает конфигурацию из .env и окружения. Настройки из startupSettings
+// остаются прежними до перезапуска.
+func (a *app) handleReloadCommand(message *tgbotapi.Message) {
+	if !a.requireAdmin(message) {
+		return
+	}
+	chatID := message.Chat.ID
+	old := a.cfg()
+	cfg, err := config.Reload()
+	if err != nil {
+		log.Printf("Error reloading config: %v", err)
+		a.bot.Send(tgbotapi.NewMessage(chatID, "Не удалось перечитать конфигурацию: "+err.Error()))
+		return
+	}
+	if cfg.AccessControl && len(cfg.AdminIDs) == 0 {
+		a.bot.Send(tgbotapi.NewMessage(chatID, "Конфигурация не применена: при ACCESS_CONTROL=true список ADMIN_IDS не может быть пустым."))
+		return
+	}
+
+	var applied, restart []string
+	for _, name := range config.Changed(old, cfg) {
+		if slices.Contains(startupSettings, name) {
+			restart = append(restart, name)
+		} else {
+			applied = append(applied, name)
+		}
+	}
+	config.Restore(cfg, old, startupSettings)
+	a.config.Store(cfg)
+	a.quota.SetDefaults(quotaDefaults(cfg))
+	log.Printf("Admin %d reloaded config: applied %v, restart required for %v", message.From.ID, applied, restart)
+
+	text := "Конфигурация перечитана, изменений нет."
+	if len(applied) > 0 {
+		text = "Конфигурация перечитана. Применено: " + strings.Join(applied, ", ") + "."
+	}
+	if len(restart) > 0 {
+		text += "\nДействуют после перезапуска: " + strings.Join(restart, ", ") + "."
+	}
+	a.bot.Send(tgbotapi.NewMessage(chatID, text))
+}
+
+// quotaDefaults лимиты квот по умолчанию из конфигурации
+func quotaDefaults(cfg *config.Config) model.QuotaLimits {
+	return model.QuotaLimits{
+		AudioMinutesPerDay: cfg.QuotaAudioMinutesPerDay,
+		SummariesPerHour:   cfg.QuotaSummariesPerHour,
+		MaxDurationMinutes: cfg.QuotaMaxDurationMinutes,
+	}
+}
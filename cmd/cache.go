@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"main/internal/model"
+	"main/internal/source"
+	"main/internal/storage"
+	"main/internal/stt"
+	"main/internal/summary"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// cacheNotBefore самое раннее время сохранения, при котором запись кэша еще действительна
+func (a *app) cacheNotBefore() time.Time {
+	return time.Now().Add(-a.cfg().CacheTTL)
+}
+
+// cachedTranscript возвращает транскрипт видео из кэша или nil, если его нет или кэш выключен
+func (a *app) cachedTranscript(videoID, language string) *model.CachedTranscript {
+	if a.cfg().CacheTTL <= 0 {
+		return nil
+	}
+	cached, err := a.repo.GetCachedTranscript(videoID, language, a.cacheNotBefore())
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Error loading cached transcript for %s: %v", videoID, err)
+		}
+		return nil
+	}
+	return cached
+}
+
+func (a *app) cacheTranscript(videoID, language, textSource string, metadata *model.VideoMetadata, transcript *stt.Transcript) {
+	if a.cfg().CacheTTL <= 0 {
+		return
+	}
+	err := a.repo.SaveCachedTranscript(&model.CachedTranscript{
+		VideoID:  videoID,
+		Language: language,
+		Source:   textSource,
+		Metadata: *metadata,
+		Text:     transcript.Text,
+		Duration: transcript.Duration,
+		Segments: transcript.Segments,
+	})
+	if err != nil {
+		log.Printf("Error caching transcript for %s: %v", videoID, err)
+	}
+}
+
+// cachedSummary возвращает результат нейросети из кэша или nil
+func (a *app) cachedSummary(videoID, language, variant string) *model.CachedSummary {
+	if a.cfg().CacheTTL <= 0 {
+		return nil
+	}
+	cached, err := a.repo.GetCachedSummary(videoID, language, variant, a.cacheNotBefore())
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Error loading cached summary for %s: %v", videoID, err)
+		}
+		return nil
+	}
+	return cached
+}
+
+func (a *app) cacheSummary(videoID, language, variant, videoSummary string) {
+	if a.cfg().CacheTTL <= 0 {
+		return
+	}
+	err := a.repo.SaveCachedSummary(&model.CachedSummary{
+		VideoID:  videoID,
+		Language: language,
+		Variant:  variant,
+		Summary:  videoSummary,
+	})
+	if err != nil {
+		log.Printf("Error caching summary for %s: %v", videoID, err)
+	}
+}
+
+// summaryVariant параметры запроса к нейросети, от которых зависит результат
+func (a *app) summaryVariant(settings model.UserSettings) string {
+	chatModel := settings.ChatModel
+	if chatModel == "" {
+		chatModel = a.cfg().ChatModel
+	}
+	return strings.Join([]string{a.prompts.Get(settings.PromptPreset).Name, chatModel, settings.SummaryLanguage, settings.SummaryStyle}, "|")
+}
+
+// cacheNote подпись к результату из кэша с подсказкой, как обработать видео заново
+func cacheNote(createdAt time.Time, request string) string {
+	return fmt.Sprintf("\n\n♻️ Результат из кэша от %s. Обработать заново: /refresh %s", createdAt.Format("02.01.2006 15:04"), request)
+}
+
+// refreshRequest аргументы /refresh для той же ссылки и того же фрагмента
+func refreshRequest(videoURL string, timeRange source.TimeRange) string {
+	if timeRange.IsZero() {
+		return videoURL
+	}
+	request := videoURL + " " + summary.FormatTimestamp(timeRange.Start) + "-"
+	if timeRange.End > 0 {
+		request += summary.FormatTimestamp(timeRange.End)
+	}
+	return request
+}
+
+// handleRefreshCommand ставит видео в очередь в обход кэша: /refresh <ссылка> [фрагмент]
+func (a *app) handleRefreshCommand(message *tgbotapi.Message) {
+	request, ok, err := a.parseURLRequest(message.CommandArguments())
+	if !ok || err != nil {
+		text := "Укажите ссылку на видео: /refresh <ссылка>"
+		if err != nil {
+			text = rangeHint
+		}
+		msg := tgbotapi.NewMessage(message.Chat.ID, text)
+		msg.ReplyToMessageID = message.MessageID
+		a.bot.Send(msg)
+		return
+	}
+	a.handleURLMessage(message, request, true)
+}
+
+// Как часто удалять устаревшие записи кэша
+const cachePruneInterval = 24 * time.Hour
+
+// runCachePruning удаляет устаревшие записи кэша при запуске и затем раз в cachePruneInterval
+func (a *app) runCachePruning(ctx context.Context) {
+	if a.cfg().CacheTTL <= 0 {
+		return
+	}
+	ticker := time.NewTicker(cachePruneInterval)
+	defer ticker.Stop()
+	for {
+		a.pruneCache()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *app) pruneCache() {
+	deleted, err := a.repo.DeleteExpiredCache(a.cacheNotBefore())
+	if err != nil {
+		log.Printf("Error pruning video cache: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Pruned %d expired video cache entries", deleted)
+	}
+}
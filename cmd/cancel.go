@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"main/internal/model"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const callbackPrefixCancel = "cancel"
+
+// cancelKeyboard кнопка отмены задачи под сообщением о прогрессе
+func cancelKeyboard(jobID int64) *tgbotapi.InlineKeyboardMarkup {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отменить", callbackPrefixCancel+":"+strconv.FormatInt(jobID, 10)),
+		),
+	)
+	return &keyboard
+}
+
+// cancelJob отменяет задачу пользователя. Если задача еще ждала в очереди, сообщение о прогрессе
+// обновляем сами; выполняющаяся задача сообщит об отмене из воркера.
+func (a *app) cancelJob(jobID int64) (bool, error) {
+	job, cancelled, err := a.queue.Cancel(jobID)
+	if err != nil {
+		return false, err
+	}
+	if cancelled && job.Status == model.JobStatusCancelled {
+		sendOrEditMessage(a.bot, job.ChatID, job.ProgressMessageID, "Обработка отменена.", job.MessageID)
+	}
+	return cancelled, nil
+}
+
+// handleCancelCallback обрабатывает кнопку cancel:<jobID>
+func (a *app) handleCancelCallback(query *tgbotapi.CallbackQuery) {
+	jobID, err := strconv.ParseInt(strings.TrimPrefix(query.Data, callbackPrefixCancel+":"), 10, 64)
+	if err != nil {
+		answerCallback(a.bot, query, "Некорректный запрос.")
+		return
+	}
+
+	job, err := a.repo.GetJob(jobID)
+	if err != nil {
+		log.Printf("Error loading job %d for cancel: %v", jobID, err)
+		answerCallback(a.bot, query, "Задача не найдена.")
+		return
+	}
+	if job.UserID != query.From.ID {
+		answerCallback(a.bot, query, "Отменить обработку может только тот, кто ее запустил.")
+		return
+	}
+
+	cancelled, err := a.cancelJob(jobID)
+	if err != nil {
+		log.Printf("Error cancelling job %d: %v", jobID, err)
+		answerCallback(a.bot, query, "Не удалось отменить обработку.")
+		return
+	}
+	if !cancelled {
+		answerCallback(a.bot, query, "Обработка уже завершена.")
+		return
+	}
+	answerCallback(a.bot, query, "Отменяю...")
+}
+
+// handleCancelCommand отменяет все незавершенные задачи пользователя в этом чате
+func (a *app) handleCancelCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	jobs, err := a.repo.ListJobsByStatus(model.JobPendingStatuses...)
+	if err != nil {
+		log.Printf("Error listing jobs for cancel in chat %d: %v", chatID, err)
+		sendOrEditMessage(a.bot, chatID, 0, "Не удалось отменить обработку, попробуйте позже.", message.MessageID)
+		return
+	}
+
+	count := 0
+	for _, job := range jobs {
+		if job.ChatID != chatID || job.UserID != message.From.ID {
+			continue
+		}
+		cancelled, err := a.cancelJob(job.ID)
+		if err != nil {
+			log.Printf("Error cancelling job %d: %v", job.ID, err)
+			continue
+		}
+		if cancelled {
+			count++
+		}
+	}
+
+	text := "Нет задач в обработке."
+	if count > 0 {
+		text = fmt.Sprintf("Отменено задач: %d.", count)
+	}
+	sendOrEditMessage(a.bot, chatID, 0, text, message.MessageID)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"main/internal/textsplit"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	messageFileFormatText     = "txt"
+	messageFileFormatMarkdown = "md"
+)
+
+// deliverText отправляет результат: первой частью редактирует messageIDToEdit (или отправляет новое
+// сообщение), остальные части идут продолжениями. Текст длиннее MESSAGE_FILE_THRESHOLD дополнительно
+// прикладывается файлом fileBaseName.txt/.md. Клавиатура markup ставится под последнюю часть.
+// Возвращает ID отправленных (и отредактированных) сообщений.
+func (a *app) deliverText(chatID int64, messageIDToEdit int, replyToMessageID int, text string, fileBaseName string, markup *tgbotapi.InlineKeyboardMarkup) []int {
+	threshold := a.cfg().MessageFileThreshold
+	if threshold <= 0 || textsplit.Length(text) <= threshold {
+		return sendOrEditMessageWithMarkup(a.bot, chatID, messageIDToEdit, text, replyToMessageID, markup)
+	}
+
+	// В сообщении оставляем начало текста, полный результат - во вложении
+	preview := textsplit.Split(text, maxMessageTextLength-200)[0]
+	notice := fmt.Sprintf("%s\n\n… Текст слишком длинный (%d символов), полная версия во вложении.", preview, textsplit.Length(text))
+	messageIDs := sendOrEditMessageWithMarkup(a.bot, chatID, messageIDToEdit, notice, replyToMessageID, nil)
+	if id := a.sendResultDocument(chatID, replyToMessageID, fileBaseName, text, markup); id != 0 {
+		messageIDs = append(messageIDs, id)
+	}
+	return messageIDs
+}
+
+// sendResultDocument отправляет текст файлом в формате MESSAGE_FILE_FORMAT и возвращает ID сообщения (0 при ошибке)
+func (a *app) sendResultDocument(chatID int64, replyToMessageID int, fileBaseName string, text string, markup *tgbotapi.InlineKeyboardMarkup) int {
+	format := strings.ToLower(a.cfg().MessageFileFormat)
+	if format != messageFileFormatMarkdown {
+		format = messageFileFormatText
+	}
+	fileName := fileBaseName + "." + format
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: fileName, Bytes: []byte(text)})
+	doc.ReplyToMessageID = replyToMessageID
+	if markup != nil {
+		doc.ReplyMarkup = markup
+	}
+	sent, err := a.bot.Send(doc)
+	if err != nil {
+		log.Printf("Error sending document %s to chat %d: %v", fileName, chatID, err)
+		return 0
+	}
+	return sent.MessageID
+}
+
+// Вспомогательная функция для отправки или редактирования сообщения
+func sendOrEditMessage(bot *tgbotapi.BotAPI, chatID int64, messageIDToEdit int, text string, replyToMessageID int) {
+	sendOrEditMessageWithMarkup(bot, chatID, messageIDToEdit, text, replyToMessageID, nil)
+}
+
+// sendOrEditMessageWithMarkup то же, что sendOrEditMessage, но с inline-клавиатурой.
+// При редактировании без клавиатуры (markup == nil) Telegram убирает прежние кнопки.
+// Текст длиннее лимита Telegram делится на части по абзацам и предложениям: первая часть
+// редактирует сообщение, остальные отправляются продолжениями, клавиатура - под последней.
+// Возвращает ID сообщений, в которых оказался текст.
+func sendOrEditMessageWithMarkup(bot *tgbotapi.BotAPI, chatID int64, messageIDToEdit int, text string, replyToMessageID int, markup *tgbotapi.InlineKeyboardMarkup) []int {
+	parts := textsplit.Split(text, maxMessageTextLength)
+	if len(parts) == 0 {
+		parts = []string{text}
+	}
+	partMarkup := func(i int) *tgbotapi.InlineKeyboardMarkup {
+		if i == len(parts)-1 {
+			return markup
+		}
+		return nil
+	}
+
+	var messageIDs []int
+	appendID := func(id int) {
+		if id != 0 {
+			messageIDs = append(messageIDs, id)
+		}
+	}
+
+	if messageIDToEdit != 0 {
+		editMsg := tgbotapi.NewEditMessageText(chatID, messageIDToEdit, parts[0])
+		editMsg.ReplyMarkup = partMarkup(0)
+		if _, err := bot.Send(editMsg); err != nil {
+			log.Printf("Error sending/editing message to chat %d: %v", chatID, err)
+			// Если редактирование не удалось, отправляем первую часть новым сообщением
+			log.Printf("Editing failed for chat %d, attempting to send as new message.", chatID)
+			appendID(sendMessagePart(bot, chatID, parts[0], replyToMessageID, partMarkup(0)))
+		} else {
+			appendID(messageIDToEdit)
+		}
+	} else {
+		appendID(sendMessagePart(bot, chatID, parts[0], replyToMessageID, partMarkup(0)))
+	}
+
+	for i := 1; i < len(parts); i++ {
+		appendID(sendMessagePart(bot, chatID, parts[i], replyToMessageID, partMarkup(i)))
+	}
+	return messageIDs
+}
+
+func sendMessagePart(bot *tgbotapi.BotAPI, chatID int64, text string, replyToMessageID int, markup *tgbotapi.InlineKeyboardMarkup) int {
+	msg := tgbotapi.NewMessage(chatID, text)
+	if replyToMessageID != 0 { // Отвечаем на исходное сообщение, если не редактируем
+		msg.ReplyToMessageID = replyToMessageID
+	}
+	if markup != nil {
+		msg.ReplyMarkup = markup
+	}
+	sent, err := bot.Send(msg)
+	if err != nil {
+		log.Printf("Error sending message to chat %d: %v", chatID, err)
+		return 0
+	}
+	return sent.MessageID
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"main/internal/model"
+	"main/internal/qa"
+	"main/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// linkResult запоминает сообщения бота с результатом, чтобы ответ на любое из них
+// считался вопросом по транскрипту исходного сообщения sourceMessageID
+func (a *app) linkResult(chatID int64, sourceMessageID int, messageIDs ...int) {
+	for _, id := range messageIDs {
+		if id == 0 {
+			continue
+		}
+		if err := a.repo.LinkMessage(chatID, id, sourceMessageID); err != nil {
+			log.Printf("Error linking message %d to %d in chat %d: %v", id, sourceMessageID, chatID, err)
+		}
+	}
+}
+
+// startConversation начинает историю диалога с краткого содержания, чтобы в вопросах можно было на него ссылаться
+func (a *app) startConversation(chatID int64, sourceMessageID int, summaryText string) {
+	history := []model.ChatMessage{{Role: "assistant", Content: summaryText}}
+	if err := a.repo.SaveConversation(chatID, sourceMessageID, history); err != nil {
+		log.Printf("Error saving conversation for message %d in chat %d: %v", sourceMessageID, chatID, err)
+	}
+}
+
+// followUpSource возвращает исходное сообщение, если message - вопрос в ответ на сообщение бота с результатом.
+// Ссылка или медиафайл в ответе - новый запрос, а не вопрос по старому транскрипту.
+func (a *app) followUpSource(message *tgbotapi.Message) (int, bool) {
+	reply := message.ReplyToMessage
+	if reply == nil || reply.From == nil || reply.From.ID != a.bot.Self.ID || message.Text == "" {
+		return 0, false
+	}
+	if _, ok := detectMedia(message); ok || message.Document != nil {
+		return 0, false
+	}
+	if _, ok, _ := a.parseURLRequest(message.Text); ok {
+		return 0, false
+	}
+	if _, _, ok := a.sources.MatchPlaylist(message.Text); ok {
+		return 0, false
+	}
+	sourceMessageID, err := a.repo.GetLinkedSource(message.Chat.ID, reply.MessageID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Error resolving follow-up source in chat %d: %v", message.Chat.ID, err)
+		}
+		return 0, false
+	}
+	return sourceMessageID, true
+}
+
+// handleFollowUp отвечает на вопрос по транскрипту с учетом предыдущих вопросов в этом чате
+func (a *app) handleFollowUp(ctx context.Context, message *tgbotapi.Message, sourceMessageID int) {
+	chatID := message.Chat.ID
+	settings := a.userSettings(message.From.ID)
+
+	transcript, err := a.repo.GetTranscript(chatID, sourceMessageID)
+	if err != nil {
+		log.Printf("Error loading transcript %d for follow-up in chat %d: %v", sourceMessageID, chatID, err)
+		sendOrEditMessage(a.bot, chatID, 0, "Не нашел транскрипт для этого сообщения, отправьте аудио или ссылку еще раз.", message.MessageID)
+		return
+	}
+	history, err := a.repo.GetConversation(chatID, sourceMessageID)
+	if err != nil {
+		log.Printf("Error loading conversation for follow-up in chat %d: %v", chatID, err)
+	}
+
+	if _, err := a.bot.Request(tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping)); err != nil {
+		log.Printf("Error sending chat action to chat %d: %v", chatID, err)
+	}
+
+	answer, history, err := a.assistant.Answer(ctx, transcript, history, message.Text, qa.Options{
+		Model:    settings.ChatModel,
+		Language: settings.SummaryLanguage,
+	})
+	if err != nil {
+		log.Printf("Error answering follow-up in chat %d: %v", chatID, err)
+		sendOrEditMessage(a.bot, chatID, 0, failureText(ctx, "Не удалось получить ответ от нейросети", err), message.MessageID)
+		return
+	}
+	if err := a.repo.SaveConversation(chatID, sourceMessageID, history); err != nil {
+		log.Printf("Error saving conversation for message %d in chat %d: %v", sourceMessageID, chatID, err)
+	}
+
+	messageIDs := a.deliverText(chatID, 0, message.MessageID, answer, fmt.Sprintf("answer_%d", message.MessageID), nil)
+	a.linkResult(chatID, sourceMessageID, messageIDs...)
+}
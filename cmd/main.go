@@ -1,32 +1,55 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"main/internal/audio"
 	"main/internal/config"
+	"main/internal/llm"
+	"main/internal/metrics"
 	"main/internal/model"
+	"main/internal/prompt"
+	"main/internal/qa"
+	"main/internal/queue"
+	"main/internal/quota"
+	"main/internal/source"
+	"main/internal/storage"
+	"main/internal/stt"
+	"main/internal/summary"
+	"main/internal/usage"
+	"main/internal/webhook"
 	coreconfig "main/tools/pkg/core_config"
-	"mime/multipart"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
-	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 const (
-	concurrencyLimit            = 10
-	bothubApiURL                = "https://bothub.chat/api/v2/openai/v1/audio/transcriptions"
-	bothubChatCompletionsApiURL = "https://bothub.chat/api/v2/openai/v1/chat/completions"
-	defaultAudioModel           = "whisper-1"
-	gptModelForYoutubeSummary   = "gpt-4o"
-	maxMessageTextLength        = 4096
+	concurrencyLimit     = 10
+	maxMessageTextLength = 4096
+
+	uploadDir           = "./upload"
+	youtubeAudioPrefix  = "youtube_audio_"
+	youtubeAudioPattern = youtubeAudioPrefix + "*.mp3"
+
+	// Сколько ждать выхода задач после их принудительной отмены
+	shutdownCancelGrace = 15 * time.Second
+
+	updatesModePolling = "polling"
+	updatesModeWebhook = "webhook"
 
 	menuCommandRecognize   = "🎤 Распознать речь"
 	menuCommandInfo        = "ℹ️ Информация"
@@ -34,104 +57,30 @@ const (
 	menuCommandYoutubeInfo = "🎞️ Инфо о Youtube-видео" // Новый пункт меню
 )
 
-var youtubeRegex = regexp.MustCompile(`^(https?://)?(www\.)?(youtube\.com/watch\?v=|youtu\.be/|youtube\.com/shorts/)[\w-]+(\S*)?$`)
-
-func isValidYoutubeLink(url string) bool {
-	return youtubeRegex.MatchString(url)
+// app зависимости, общие для всех обработчиков обновлений
+type app struct {
+	bot         *tgbotapi.BotAPI
+	config      atomic.Pointer[config.Config] // заменяется целиком при /reload, см. cfg
+	transcriber stt.Transcriber
+	summarizer  *summary.Summarizer
+	sources     *source.Registry
+	prompts     *prompt.Library
+	assistant   *qa.Assistant
+	repo        storage.Repository
+	queue       *queue.Queue
+	quota       *quota.Limiter
+	usage       *usage.Tracker
+
+	broadcasting atomic.Bool    // идет рассылка /broadcast
+	background   sync.WaitGroup // фоновые задачи вне обработчиков обновлений (рассылка), их ждет остановка бота
 }
 
-func recognizeSpeech(audioFilePath string, cfg *config.Config) (string, error) {
-	log.Printf("STT: Processing %s with Bothub API", audioFilePath)
-
-	file, err := os.Open(audioFilePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to open audio file %s: %w", audioFilePath, err)
-	}
-	defer file.Close()
-
-	var requestBody bytes.Buffer
-	multipartWriter := multipart.NewWriter(&requestBody)
-
-	fileWriter, err := multipartWriter.CreateFormFile("file", filepath.Base(audioFilePath))
-	if err != nil {
-		return "", fmt.Errorf("failed to create form file for %s: %w", audioFilePath, err)
-	}
-	_, err = io.Copy(fileWriter, file)
-	if err != nil {
-		return "", fmt.Errorf("failed to copy file content to multipart writer: %w", err)
-	}
-
-	err = multipartWriter.WriteField("model", defaultAudioModel)
-	if err != nil {
-		return "", fmt.Errorf("failed to write model field to multipart writer: %w", err)
-	}
-
-	err = multipartWriter.Close()
-	if err != nil {
-		return "", fmt.Errorf("failed to close multipart writer: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", bothubApiURL, &requestBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to create new HTTP request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+cfg.BothubApiToken)
-	req.Header.Set("Content-Type", multipartWriter.FormDataContentType())
-
-	client := &http.Client{Timeout: 60 * time.Second} // Увеличен таймаут для потенциально больших файлов
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to execute HTTP request to Bothub API: %w", err)
-	}
-	defer resp.Body.Close()
-
-	responseBodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response body from Bothub API: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Bothub API returned non-OK status: %s. Response: %s", resp.Status, string(responseBodyBytes))
-		var errorResp model.TranscriptionResponse
-		if json.Unmarshal(responseBodyBytes, &errorResp) == nil && errorResp.Error != nil {
-			return "", fmt.Errorf("Bothub API error: %s (Type: %s, Code: %s, Param: %s), HTTP Status: %s",
-				errorResp.Error.Message, errorResp.Error.Type, errorResp.Error.Code, errorResp.Error.Param, resp.Status)
-		}
-		return "", fmt.Errorf("Bothub API request failed with status %s and body: %s", resp.Status, string(responseBodyBytes))
-	}
-
-	var transcriptionResp model.TranscriptionResponse
-	err = json.Unmarshal(responseBodyBytes, &transcriptionResp)
-	if err != nil {
-		return "", fmt.Errorf("failed to unmarshal JSON response from Bothub API (%s): %w. Response body: %s", resp.Status, err, string(responseBodyBytes))
-	}
-
-	if transcriptionResp.Error != nil {
-		return "", fmt.Errorf("Bothub API returned an error in JSON response: %s (Type: %s)", transcriptionResp.Error.Message, transcriptionResp.Error.Type)
-	}
-	if transcriptionResp.Text == "" && transcriptionResp.Error == nil {
-		log.Printf("Warning: Bothub API returned OK status but no text. Response: %s", string(responseBodyBytes))
-		// Не возвращаем ошибку, если текст просто пустой, но нет явной ошибки API.
-		// Это может означать тишину в аудио.
-	}
-
-	log.Printf("STT: Successfully recognized text: \"%s\"", transcriptionResp.Text)
-	return transcriptionResp.Text, nil
+// cfg текущая конфигурация. Значения читаются при каждом обращении: после /reload действуют новые.
+func (a *app) cfg() *config.Config {
+	return a.config.Load()
 }
 
-func convertOgaToWav(ogaPath string, wavPath string) error {
-	cmd := exec.Command("ffmpeg", "-i", ogaPath, "-y", "-acodec", "pcm_s16le", "-ar", "16000", "-ac", "1", wavPath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("ffmpeg error for %s -> %s: %v\nOutput: %s", ogaPath, wavPath, err, string(output))
-		return fmt.Errorf("ffmpeg conversion failed: %w. Output: %s", err, string(output))
-	}
-	log.Printf("Converted %s to %s", ogaPath, wavPath)
-	return nil
-}
-
-func downloadFile(bot *tgbotapi.BotAPI, fileID string, localPath string) error {
+func downloadFile(ctx context.Context, bot *tgbotapi.BotAPI, fileID string, localPath string) error {
 	fileConfig := tgbotapi.FileConfig{FileID: fileID}
 	file, err := bot.GetFile(fileConfig)
 	if err != nil {
@@ -150,7 +99,11 @@ func downloadFile(bot *tgbotapi.BotAPI, fileID string, localPath string) error {
 			ExpectContinueTimeout: 1 * time.Second,
 		},
 	}
-	resp, err := client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("http.Get failed for %s: %w", url, err)
 	}
@@ -172,326 +125,291 @@ func downloadFile(bot *tgbotapi.BotAPI, fileID string, localPath string) error {
 	return nil
 }
 
-func handleVoiceMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, cfg *config.Config) {
-	voice := message.Voice
+// handleURLMessage ставит обработку видео по ссылке в очередь. Сообщение о прогрессе
+// сохраняется в задаче, чтобы воркер (в том числе после перезапуска бота) мог его редактировать.
+// refresh - обработать заново, не используя кэш.
+func (a *app) handleURLMessage(message *tgbotapi.Message, request urlRequest, refresh bool) {
+	bot := a.bot
 	chatID := message.Chat.ID
+	videoURL := request.url
 
-	log.Printf("[%s] (ChatID: %d) sent a voice message (FileID: %s, Duration: %d)",
-		message.From.UserName, chatID, voice.FileID, voice.Duration)
-
-	ogaTempFile, err := os.CreateTemp("", "voice-*.oga")
-	if err != nil {
-		log.Printf("Error creating temp oga file: %v", err)
-		bot.Send(tgbotapi.NewMessage(chatID, "Ошибка сервера: не удалось создать временный файл для аудио."))
+	reservedAt := time.Now()
+	if reserved, status := a.reserveSummaries(message.From.ID, 1); reserved == 0 {
+		msg := tgbotapi.NewMessage(chatID, summaryQuotaText(status))
+		msg.ReplyToMessageID = message.MessageID
+		bot.Send(msg)
 		return
 	}
-	ogaFilePath := ogaTempFile.Name()
-	ogaTempFile.Close()
-	defer func() {
-		log.Printf("Attempting to remove oga file: %s", ogaFilePath)
-		if err := os.Remove(ogaFilePath); err != nil && !os.IsNotExist(err) {
-			log.Printf("Error removing temp oga file %s: %v", ogaFilePath, err)
-		}
-	}()
 
-	err = downloadFile(bot, voice.FileID, ogaFilePath)
-	if err != nil {
-		log.Printf("Error downloading voice file (ID: %s): %v", voice.FileID, err)
-		bot.Send(tgbotapi.NewMessage(chatID, "Не удалось скачать голосовое сообщение."))
-		return
+	text := "Получил ссылку, поставил видео в очередь на обработку. Это может занять некоторое время..."
+	if !request.timeRange.IsZero() {
+		text = fmt.Sprintf("Получил ссылку, поставил в очередь фрагмент видео %s. Это может занять некоторое время...", formatRange(request.timeRange))
 	}
-
-	wavTempFile, err := os.CreateTemp("", "voice-*.wav")
-	if err != nil {
-		log.Printf("Error creating temp wav file: %v", err)
-		bot.Send(tgbotapi.NewMessage(chatID, "Ошибка сервера: не удалось создать временный файл для конвертации."))
-		return
-	}
-	wavFilePath := wavTempFile.Name()
-	wavTempFile.Close()
-	defer func() {
-		log.Printf("Attempting to remove wav file: %s", wavFilePath)
-		if err := os.Remove(wavFilePath); err != nil && !os.IsNotExist(err) {
-			log.Printf("Error removing temp wav file %s: %v", wavFilePath, err)
-		}
-	}()
-
-	err = convertOgaToWav(ogaFilePath, wavFilePath)
+	processingMsg := tgbotapi.NewMessage(chatID, text)
+	processingMsg.ReplyToMessageID = message.MessageID
+	sentMsg, err := bot.Send(processingMsg)
 	if err != nil {
-		log.Printf("Error converting audio from %s to %s: %v", ogaFilePath, wavFilePath, err)
-		bot.Send(tgbotapi.NewMessage(chatID, "Ошибка конвертации аудио."))
-		return
+		log.Printf("Error sending processing message: %v", err)
 	}
 
-	recognizedText, err := recognizeSpeech(wavFilePath, cfg)
-	if err != nil {
-		log.Printf("Error recognizing speech for file %s: %v", wavFilePath, err)
-		bot.Send(tgbotapi.NewMessage(chatID, "Не удалось распознать речь."))
+	job := &model.Job{
+		ChatID:            chatID,
+		MessageID:         message.MessageID,
+		ProgressMessageID: sentMsg.MessageID,
+		Kind:              model.JobKindURL,
+		Source:            videoURL,
+		Refresh:           refresh,
+		RangeStart:        request.timeRange.Start,
+		RangeEnd:          request.timeRange.End,
+		UserID:            message.From.ID,
+		CreatedAt:         reservedAt, // по нему возвращается квота, если задача не выполнится
+	}
+	if err := a.queue.Enqueue(job); err != nil {
+		log.Printf("Error enqueueing job for %s: %v", videoURL, err)
+		a.releaseSummary(job.UserID, job.CreatedAt)
+		sendOrEditMessage(bot, chatID, sentMsg.MessageID, "Не удалось поставить видео в очередь, попробуйте позже.", message.MessageID)
 		return
 	}
-
-	msg := tgbotapi.NewMessage(chatID, recognizedText)
-	if recognizedText == "" {
-		msg.Text = "Не удалось извлечь текст из голосового сообщения (результат пуст)."
-	}
-	msg.ReplyToMessageID = message.MessageID
-	if _, err := bot.Send(msg); err != nil {
-		log.Printf("Error sending message to chat %d: %v", chatID, err)
+	if sentMsg.MessageID != 0 {
+		if _, err := bot.Request(tgbotapi.NewEditMessageReplyMarkup(chatID, sentMsg.MessageID, *cancelKeyboard(job.ID))); err != nil {
+			log.Printf("Error adding cancel button for job %d: %v", job.ID, err)
+		}
 	}
 }
 
-func downloadAudioFromYoutube(youtubeURL string, cfg *config.Config) (string, error) { // <--- Добавлен cfg
-	//	tempFile, err := os.CreateTemp(os.TempDir(), "youtube_audio_*.mp3")
-	tempFile, err := os.CreateTemp("./upload", "youtube_audio_*.mp3")
-	if err != nil {
-		return "", fmt.Errorf("failed to create temp file for youtube audio name: %w", err)
-	}
-	mp3FilePath := tempFile.Name()
-	if err := tempFile.Close(); err != nil {
-		log.Printf("Warning: failed to close temp file handle for %s: %v", mp3FilePath, err)
-	}
-	os.Remove(mp3FilePath)
-
-	log.Printf("Downloading audio from YouTube URL: %s to %s", youtubeURL, mp3FilePath)
-
-	args := []string{
-		"-o", mp3FilePath, // путь для сохранения
-		"-x", // извлечь аудио
-		"--audio-format", "mp3",
-		"--no-playlist", // не скачивать плейлист
-		"--quiet",       // меньше вывода
-		"--no-warnings", // нет предупреждений
+// processJob выполняет задачу очереди в зависимости от ее вида
+func (a *app) processJob(ctx context.Context, job *model.Job) error {
+	ctx = usage.WithOwner(ctx, job.UserID, job.ChatID)
+	if job.Kind == model.JobKindDigest {
+		return a.processDigestJob(ctx, job)
 	}
+	return a.processURLJob(ctx, job)
+}
 
-	// Добавляем cookies, если путь указан в конфиге
-	if cfg.YoutubeCookiesPath != "" {
-		// Проверяем, существует ли файл cookies
-		if _, err := os.Stat(cfg.YoutubeCookiesPath); err == nil {
-			log.Printf("Using YouTube cookies from: %s", cfg.YoutubeCookiesPath)
-			args = append(args, "--cookies", cfg.YoutubeCookiesPath)
-		} else {
-			log.Printf("WARNING: YouTube cookies file specified but not found at %s: %v. Proceeding without cookies.", cfg.YoutubeCookiesPath, err)
-		}
-	} else {
-		log.Println("WARNING: YouTube cookies file not specified in config. Downloads may fail due to bot detection.")
+// transcriptMessageID сообщение, к которому привязываются транскрипт и вопросы по результату задачи.
+// У видео плейлиста общее исходное сообщение, поэтому для них используется собственное сообщение о прогрессе.
+func transcriptMessageID(job *model.Job) int {
+	if job.BatchID != 0 && job.ProgressMessageID != 0 {
+		return job.ProgressMessageID
 	}
+	return job.MessageID
+}
 
-	args = append(args, youtubeURL) // URL всегда последний
-
-	cmd := exec.Command("yt-dlp", args...)
-
-	var stdOutAndErr bytes.Buffer
-	cmd.Stdout = &stdOutAndErr
-	cmd.Stderr = &stdOutAndErr
-
-	err = cmd.Run()
-	if err != nil {
-		log.Printf("yt-dlp error for URL %s: %v\nOutput: %s", youtubeURL, err, stdOutAndErr.String())
-		if _, statErr := os.Stat(mp3FilePath); statErr == nil {
-			os.Remove(mp3FilePath)
+// processURLJob скачивает аудио, распознает речь и делает краткое содержание видео из задачи очереди
+func (a *app) processURLJob(ctx context.Context, job *model.Job) error {
+	bot := a.bot
+	chatID := job.ChatID
+	videoURL := job.Source
+	messageIDToEdit := job.ProgressMessageID
+	settings := a.userSettings(job.UserID)
+	cfg := a.cfg()
+
+	setStatus := func(status, text string) {
+		if err := a.queue.SetStatus(job, status); err != nil {
+			log.Printf("Error updating job %d status: %v", job.ID, err)
 		}
-		return "", fmt.Errorf("yt-dlp failed: %w. Output: %s", err, stdOutAndErr.String())
-	}
-
-	fileInfo, err := os.Stat(mp3FilePath)
-	if os.IsNotExist(err) {
-		log.Printf("yt-dlp ran but output file %s not found. Output: %s", mp3FilePath, stdOutAndErr.String())
-		return "", fmt.Errorf("yt-dlp output file not found: %s. Output: %s", mp3FilePath, stdOutAndErr.String())
+		sendOrEditMessageWithMarkup(bot, chatID, messageIDToEdit, text, 0, cancelKeyboard(job.ID))
 	}
-	if err != nil {
-		log.Printf("Error stating output file %s: %v. Output: %s", mp3FilePath, err, stdOutAndErr.String())
-		return "", fmt.Errorf("error stating yt-dlp output file %s: %w. Output: %s", mp3FilePath, err, stdOutAndErr.String())
-	}
-	if fileInfo.Size() == 0 {
-		log.Printf("yt-dlp created an empty file %s. Output: %s", mp3FilePath, stdOutAndErr.String())
-		os.Remove(mp3FilePath)
-		return "", fmt.Errorf("yt-dlp created an empty file: %s. Output: %s", mp3FilePath, stdOutAndErr.String())
+	fail := func(prefix string, err error) error {
+		sendOrEditMessage(bot, chatID, messageIDToEdit, failureText(ctx, prefix, err), job.MessageID)
+		return fmt.Errorf("%s: %w", prefix, err)
 	}
 
-	log.Printf("Successfully downloaded audio to %s (size: %d bytes)", mp3FilePath, fileInfo.Size())
-	return mp3FilePath, nil
-}
-
-func getChatCompletionFromBothub(text string, cfg *config.Config) (string, error) {
-	log.Printf("Requesting chat completion from Bothub for text starting with: %.80s...", text)
-
-	// Формируем контент для запроса.
-	// Согласно заданию, распознанный текст передается в поле content.
-	// Чтобы получить осмысленную информацию *о видео* на основе этого текста,
-	// лучше сформулировать запрос к модели.
-	userContent := "Проанализируй следующий текст, который был извлечен из аудиодорожки YouTube видео, и предоставь краткое содержание или ключевые моменты этого видео (отвечай на русском языке):\n\n\"" + text + "\""
-	// Если строго следовать "текст передается в content", то userContent = text.
-	// Однако, API ожидает инструкцию в 'content', как в примере "Tell me about Fiji".
-	// Мой вариант userContent является такой инструкцией, включающей текст.
-
-	requestPayload := model.ChatCompletionRequest{
-		Model: gptModelForYoutubeSummary,
-		Messages: []model.ChatMessage{
-			{
-				Role:    "user",
-				Content: userContent,
-			},
-		},
+	// Список площадок и разрешенных хостов мог измениться, пока задача ждала в очереди
+	src, u, ok := a.sources.Match(videoURL)
+	if !ok {
+		return fail("Ссылка больше не поддерживается", fmt.Errorf("unsupported url %s", videoURL))
 	}
+	timeRange := source.TimeRange{Start: job.RangeStart, End: job.RangeEnd}
+	videoID := rangeCacheKey(src.VideoID(u), timeRange)
 
-	requestBodyBytes, err := json.Marshal(requestPayload)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal chat completion request: %w", err)
+	// Транскрипт этого видео мог уже получить другой пользователь
+	var cached *model.CachedTranscript
+	if !job.Refresh {
+		cached = a.cachedTranscript(videoID, settings.TranscriptionLanguage)
 	}
 
-	req, err := http.NewRequest("POST", bothubChatCompletionsApiURL, bytes.NewBuffer(requestBodyBytes))
-	if err != nil {
-		return "", fmt.Errorf("failed to create new HTTP request for chat completion: %w", err)
-	}
+	var metadata *model.VideoMetadata
+	var transcript *stt.Transcript
+	textSource := "аудиодорожки"
+	if cached != nil {
+		log.Printf("Using cached transcript for %s (%s) from %s", videoURL, videoID, cached.CreatedAt.Format(time.RFC3339))
+		metadata = &cached.Metadata
+		transcript = &stt.Transcript{Text: cached.Text, Duration: cached.Duration, Segments: cached.Segments}
+		textSource = cached.Source
+	} else {
+		// 1. Получить сведения о видео: название, канал, описание и главы попадут в запрос и в ответ
+		// Для прямой ссылки на файл метаданных нет, названием служит имя файла
+		metadata = &model.VideoMetadata{Title: directFileTitle(videoURL)}
+		if !src.Direct {
+			setStatus(model.JobStatusDownloading, "Получаю информацию о видео...")
+			fetched, err := fetchVideoMetadata(ctx, videoURL, src, cfg)
+			if err == nil {
+				metadata = fetched
+				metadata.Chapters = clipChapters(metadata.Chapters, timeRange)
+			} else if ctx.Err() != nil {
+				return fail("Не удалось получить информацию о видео", err)
+			} else {
+				// Без метаданных обработка продолжается, просто без заголовка и глав
+				log.Printf("Error fetching metadata for %s video %s: %v", src.Name, videoURL, err)
+				metadata = &model.VideoMetadata{}
+			}
+		}
+		if text := a.durationLimitText(job.UserID, rangeDuration(timeRange, metadata.Duration)); text != "" {
+			sendOrEditMessage(bot, chatID, messageIDToEdit, text, job.MessageID)
+			return fmt.Errorf("video %s exceeds duration limit for user %d", videoURL, job.UserID)
+		}
 
-	req.Header.Set("Authorization", "Bearer "+cfg.BothubApiToken)
-	req.Header.Set("Content-Type", "application/json")
+		// 2. Взять субтитры площадки, если они есть: это быстрее и дешевле распознавания
+		if src.Subtitles && cfg.YoutubeSubtitles {
+			setStatus(model.JobStatusDownloading, "Ищу субтитры к видео...")
+			subs, err := downloadSubtitles(ctx, videoURL, src, cfg, subtitleLanguages(cfg, settings.TranscriptionLanguage))
+			if err != nil {
+				log.Printf("Error downloading subtitles for %s: %v", videoURL, err)
+				return fail("Не удалось получить субтитры видео", err)
+			}
+			if subs != nil {
+				// Субтитры скачиваются для всего видео, из них берется только фрагмент
+				if filtered := filterTranscript(subs.transcript, timeRange); filtered.Text != "" {
+					transcript = filtered
+					textSource = subs.describe()
+				}
+			}
+		}
 
-	client := &http.Client{Timeout: 120 * time.Second} // Таймаут для LLM может быть длинным
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to execute HTTP request to Bothub Chat API: %w", err)
-	}
-	defer resp.Body.Close()
+		if transcript == nil {
+			// 3. Субтитров нет: скачать аудио (через yt-dlp или напрямую по ссылке на файл),
+			// если у пользователя хватает квоты на распознавание
+			if text := a.audioQuotaText(job.UserID, rangeDuration(timeRange, metadata.Duration)); text != "" {
+				sendOrEditMessage(bot, chatID, messageIDToEdit, text, job.MessageID)
+				return fmt.Errorf("audio quota exceeded for user %d", job.UserID)
+			}
+			setStatus(model.JobStatusDownloading, "Скачиваю аудио из видео...")
+			var mp3FilePath string
+			var err error
+			if src.Direct {
+				mp3FilePath, err = downloadDirectAudio(ctx, a.sources, videoURL, cfg, timeRange)
+			} else {
+				mp3FilePath, err = downloadAudioWithYtdlp(ctx, videoURL, src, cfg, timeRange)
+			}
+			if err != nil {
+				log.Printf("Error downloading audio from %s: %v", videoURL, err)
+				return fail("Не удалось скачать аудио из видео", err)
+			}
+			defer func() {
+				log.Printf("Attempting to remove downloaded audio file: %s", mp3FilePath)
+				if errRem := os.Remove(mp3FilePath); errRem != nil && !os.IsNotExist(errRem) {
+					log.Printf("Error removing temp audio file %s: %v", mp3FilePath, errRem)
+				}
+			}()
 
-	responseBodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response body from Bothub Chat API: %w", err)
-	}
+			setStatus(model.JobStatusTranscribing, "Аудио извлечено, распознаю речь...")
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Bothub Chat API returned non-OK status: %s. Response: %s", resp.Status, string(responseBodyBytes))
-		var errorResp model.ChatCompletionResponse
-		if json.Unmarshal(responseBodyBytes, &errorResp) == nil && errorResp.Error != nil {
-			return "", fmt.Errorf("Bothub Chat API error: %s (Type: %s, Code: %s, Param: %s), HTTP Status: %s",
-				errorResp.Error.Message, errorResp.Error.Type, errorResp.Error.Code, errorResp.Error.Param, resp.Status)
+			// 4. Распознать речь из аудиофайла
+			transcript, err = a.transcriber.Transcribe(ctx, mp3FilePath, stt.Options{Language: settings.TranscriptionLanguage})
+			if err != nil {
+				log.Printf("Error recognizing speech from audio %s (file: %s): %v", videoURL, mp3FilePath, err)
+				return fail("Не удалось распознать речь из видео", err)
+			}
+			// Не все провайдеры возвращают длительность - тогда считаем по метаданным видео
+			a.recordTranscription(ctx, job.UserID, cmp.Or(transcript.Duration, rangeDuration(timeRange, metadata.Duration)))
+			shiftTranscript(transcript, timeRange.Start)
 		}
-		return "", fmt.Errorf("Bothub Chat API request failed with status %s and body: %s", resp.Status, string(responseBodyBytes))
 	}
 
-	var chatResponse model.ChatCompletionResponse
-	err = json.Unmarshal(responseBodyBytes, &chatResponse)
-	if err != nil {
-		return "", fmt.Errorf("failed to unmarshal JSON response from Bothub Chat API (%s): %w. Response body: %s", resp.Status, err, string(responseBodyBytes))
+	if transcript.Text == "" {
+		log.Printf("Recognized text is empty for video %s (source: %s)", videoURL, textSource)
+		sendOrEditMessage(bot, chatID, messageIDToEdit, "Не удалось извлечь текст из видео (результат распознавания пуст).", job.MessageID)
+		return fmt.Errorf("recognized text is empty")
 	}
 
-	if chatResponse.Error != nil {
-		return "", fmt.Errorf("Bothub Chat API returned an error in JSON response: %s (Type: %s)", chatResponse.Error.Message, chatResponse.Error.Type)
+	a.saveTranscript(chatID, transcriptMessageID(job), job.UserID, videoURL, transcript)
+	if cached == nil {
+		a.cacheTranscript(videoID, settings.TranscriptionLanguage, textSource, metadata, transcript)
 	}
 
-	if len(chatResponse.Choices) == 0 || chatResponse.Choices[0].Message.Content == "" {
-		log.Printf("Warning: Bothub Chat API returned OK status but no content. Response: %s", string(responseBodyBytes))
-		return "", fmt.Errorf("Bothub Chat API returned no content in response. Response body: %s", string(responseBodyBytes))
+	// 5. Передать текст в Bothub Chat Completions API, если такого результата еще нет в кэше
+	variant := a.summaryVariant(settings)
+	var cachedSummary *model.CachedSummary
+	if cached != nil {
+		cachedSummary = a.cachedSummary(videoID, settings.TranscriptionLanguage, variant)
 	}
-
-	log.Printf("Bothub Chat API successfully returned completion.")
-	return chatResponse.Choices[0].Message.Content, nil
-}
-
-func handleYoutubeVideoInfoProcessing(bot *tgbotapi.BotAPI, message *tgbotapi.Message, cfg *config.Config) {
-	chatID := message.Chat.ID
-	youtubeURL := message.Text
-
-	processingMsg := tgbotapi.NewMessage(chatID, "Получил ссылку, начинаю обработку видео. Это может занять некоторое время...")
-	processingMsg.ReplyToMessageID = message.MessageID
-	sentMsg, err := bot.Send(processingMsg)
-	var messageIDToEdit int
-	if err == nil && sentMsg.MessageID != 0 {
-		messageIDToEdit = sentMsg.MessageID
-	} else if err != nil {
-		log.Printf("Error sending processing message: %v", err)
+	if cachedSummary != nil {
+		return a.deliverVideoResult(job, metadata, textSource, cachedSummary.Summary, transcript, cacheNote(cachedSummary.CreatedAt, refreshRequest(videoURL, timeRange)))
 	}
+	setStatus(model.JobStatusSummarizing, fmt.Sprintf("Текст из видео получен из %s, запрашиваю информацию у нейросети...", textSource))
 
-	// 1. Скачать аудио с YouTube
-	mp3FilePath, err := downloadAudioFromYoutube(youtubeURL, cfg)
-	if err != nil {
-		log.Printf("Error downloading audio from YouTube %s: %v", youtubeURL, err)
-		replyText := fmt.Sprintf("Не удалось скачать аудио из видео: %v", err)
-		sendOrEditMessage(bot, chatID, messageIDToEdit, replyText, message.MessageID)
-		return
+	duration := rangeDuration(timeRange, metadata.Duration)
+	if duration == 0 {
+		duration = transcript.Duration
 	}
-	defer func() {
-		log.Printf("Attempting to remove YouTube audio file: %s", mp3FilePath)
-		if errRem := os.Remove(mp3FilePath); errRem != nil && !os.IsNotExist(errRem) {
-			log.Printf("Error removing temp YouTube audio file %s: %v", mp3FilePath, errRem)
-		}
-	}()
-
-	sendOrEditMessage(bot, chatID, messageIDToEdit, "Аудио извлечено, распознаю речь...", 0)
-
-	// 2. Распознать речь из аудиофайла
-	recognizedText, err := recognizeSpeech(mp3FilePath, cfg)
+	videoSummary, err := a.summarizer.Summarize(ctx, transcript.Text, transcript.Segments, summary.Options{
+		Model:       settings.ChatModel,
+		Language:    settings.SummaryLanguage,
+		Style:       settings.SummaryStyle,
+		Preset:      settings.PromptPreset,
+		Title:       metadata.Title,
+		Duration:    duration,
+		Channel:     metadata.Channel,
+		UploadDate:  metadata.UploadDate,
+		Description: metadata.Description,
+		Chapters:    metadata.Chapters,
+	})
 	if err != nil {
-		log.Printf("Error recognizing speech from YouTube audio %s (file: %s): %v", youtubeURL, mp3FilePath, err)
-		replyText := fmt.Sprintf("Не удалось распознать речь из видео: %v", err)
-		sendOrEditMessage(bot, chatID, messageIDToEdit, replyText, message.MessageID)
-		return
+		log.Printf("Error getting info from Bothub Chat API for video %s: %v", videoURL, err)
+		return fail("Не удалось получить информацию о видео от нейросети", err)
 	}
+	a.cacheSummary(videoID, settings.TranscriptionLanguage, variant, videoSummary)
 
-	if recognizedText == "" {
-		log.Printf("Recognized text is empty for YouTube audio %s (file: %s)", youtubeURL, mp3FilePath)
-		replyText := "Не удалось извлечь текст из видео (результат распознавания пуст)."
-		sendOrEditMessage(bot, chatID, messageIDToEdit, replyText, message.MessageID)
-		return
-	}
-
-	sendOrEditMessage(bot, chatID, messageIDToEdit, "Текст из видео получен, запрашиваю информацию у нейросети...", 0)
-
-	// 3. Передать текст в Bothub Chat Completions API
-	summary, err := getChatCompletionFromBothub(recognizedText, cfg)
-	if err != nil {
-		log.Printf("Error getting info from Bothub Chat API for YouTube video %s: %v", youtubeURL, err)
-		replyText := fmt.Sprintf("Не удалось получить информацию о видео от нейросети: %v", err)
-		sendOrEditMessage(bot, chatID, messageIDToEdit, replyText, message.MessageID)
-		return
+	note := ""
+	if cached != nil {
+		note = cacheNote(cached.CreatedAt, refreshRequest(videoURL, timeRange))
 	}
-
-	// 4. Отправить результат пользователю
-	finalReply := fmt.Sprintf("Информация о видео (на основе аудиодорожки):\n\n%s", summary)
-	sendOrEditMessage(bot, chatID, messageIDToEdit, finalReply, message.MessageID)
+	return a.deliverVideoResult(job, metadata, textSource, videoSummary, transcript, note)
 }
 
-// Вспомогательная функция для отправки или редактирования сообщения
-func sendOrEditMessage(bot *tgbotapi.BotAPI, chatID int64, messageIDToEdit int, text string, replyToMessageID int) {
-	var chattable tgbotapi.Chattable
-	if messageIDToEdit != 0 {
-		editMsg := tgbotapi.NewEditMessageText(chatID, messageIDToEdit, text)
-		if len(editMsg.Text) > maxMessageTextLength {
-			editMsg.Text = editMsg.Text[:maxMessageTextLength-3] + "..."
-		}
-		chattable = editMsg
+// deliverVideoResult отправляет пользователю результат обработки видео; note добавляется в конец ответа
+func (a *app) deliverVideoResult(job *model.Job, metadata *model.VideoMetadata, textSource, videoSummary string, transcript *stt.Transcript, note string) error {
+	bot := a.bot
+	chatID := job.ChatID
+	messageIDToEdit := job.ProgressMessageID
+	settings := a.userSettings(job.UserID)
+	sourceMessageID := transcriptMessageID(job)
+	job.Result = videoSummary
+
+	// 6. Отправить результат пользователю
+	timeRange := source.TimeRange{Start: job.RangeStart, End: job.RangeEnd}
+	finalReply := fmt.Sprintf("%sИнформация о видео (на основе %s):\n\n%s%s", videoHeader(metadata, timeRange), textSource, videoSummary, note)
+	if settings.OutputFormat == model.OutputFormatFile {
+		sendOrEditMessage(bot, chatID, messageIDToEdit, "Информация о видео готова, отправляю файлом.", job.MessageID)
+		messageID := a.sendResultDocument(chatID, job.MessageID, fmt.Sprintf("summary_%d", sourceMessageID), finalReply, nil)
+		a.linkResult(chatID, sourceMessageID, messageIDToEdit, messageID)
 	} else {
-		newMsg := tgbotapi.NewMessage(chatID, text)
-		if replyToMessageID != 0 { // Отвечаем на исходное сообщение, если не редактируем
-			newMsg.ReplyToMessageID = replyToMessageID
-		}
-		if len(newMsg.Text) > maxMessageTextLength {
-			newMsg.Text = newMsg.Text[:maxMessageTextLength-3] + "..."
-		}
-		chattable = newMsg
+		messageIDs := a.deliverText(chatID, messageIDToEdit, job.MessageID, finalReply, fmt.Sprintf("summary_%d", sourceMessageID), nil)
+		a.linkResult(chatID, sourceMessageID, messageIDs...)
 	}
+	a.startConversation(chatID, sourceMessageID, videoSummary)
+	a.offerSubtitles(chatID, sourceMessageID, transcript)
+	return nil
+}
 
-	if _, err := bot.Send(chattable); err != nil {
-		log.Printf("Error sending/editing message to chat %d: %v", chatID, err)
-		// Если редактирование не удалось, можно попробовать отправить новое сообщение
-		if messageIDToEdit != 0 {
-			log.Printf("Editing failed for chat %d, attempting to send as new message.", chatID)
-			newMsgFallback := tgbotapi.NewMessage(chatID, text)
-			if replyToMessageID != 0 {
-				newMsgFallback.ReplyToMessageID = replyToMessageID
-			}
-			if len(newMsgFallback.Text) > maxMessageTextLength {
-				newMsgFallback.Text = newMsgFallback.Text[:maxMessageTextLength-3] + "..."
-			}
-			if _, fallbackErr := bot.Send(newMsgFallback); fallbackErr != nil {
-				log.Printf("Error sending fallback message to chat %d: %v", chatID, fallbackErr)
-			}
-		}
+// failureText формирует текст ошибки для пользователя. Задачу, прерванную остановкой бота,
+// очередь выполнит заново после перезапуска, о чем и сообщаем.
+func failureText(ctx context.Context, prefix string, err error) string {
+	if errors.Is(context.Cause(ctx), queue.ErrCancelled) {
+		return "Обработка отменена."
+	}
+	if errors.Is(context.Cause(ctx), queue.ErrTakenOver) {
+		return "Обработка перезапущена, результат придет в этом сообщении."
 	}
+	if ctx.Err() != nil {
+		return "Бот перезапускается: обработка продолжится автоматически после запуска."
+	}
+	return fmt.Sprintf("%s: %v", prefix, err)
 }
 
 func sendMainMenu(bot *tgbotapi.BotAPI, chatID int64) {
-	msg := tgbotapi.NewMessage(chatID, "Выберите опцию, отправьте голосовое сообщение или ссылку на Youtube-видео:")
+	msg := tgbotapi.NewMessage(chatID, "Выберите опцию, отправьте голосовое сообщение или ссылку на видео:")
 	keyboard := tgbotapi.NewReplyKeyboard(
 		tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButton(menuCommandRecognize),
@@ -516,12 +434,16 @@ func checkDependencies() {
 		missingDeps = append(missingDeps, "yt-dlp")
 	}
 	if _, err := exec.LookPath("ffmpeg"); err != nil {
-		log.Println("WARNING: ffmpeg not found in PATH. Voice message and Youtube video processing may fail.")
+		log.Println("WARNING: ffmpeg not found in PATH. Media message and Youtube video processing may fail.")
 		missingDeps = append(missingDeps, "ffmpeg")
 	}
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		log.Println("WARNING: ffprobe not found in PATH. Long audio will not be split into chunks for recognition.")
+		missingDeps = append(missingDeps, "ffprobe")
+	}
 
 	if len(missingDeps) == 0 {
-		log.Println("Dependencies (yt-dlp, ffmpeg) checked successfully.")
+		log.Println("Dependencies (yt-dlp, ffmpeg, ffprobe) checked successfully.")
 	} else {
 		log.Printf("Please install missing dependencies: %v", missingDeps)
 	}
@@ -550,7 +472,36 @@ func main() {
 		}
 	}
 
+	// ACCESS_CONTROL включается явно; без администраторов ботом не сможет пользоваться никто, кроме уже
+	// приглашенных, и выдать приглашение тоже некому
+	if cfg.AccessControl && len(cfg.AdminIDs) == 0 {
+		log.Fatal("ACCESS_CONTROL is enabled but ADMIN_IDS is empty: set ADMIN_IDS or disable ACCESS_CONTROL")
+	}
+
 	checkDependencies() // Проверка наличия yt-dlp и ffmpeg
+	cleanupTempFiles()  // Остатки от предыдущего запуска, если он завершился аварийно
+
+	transcriber, err := stt.New(cfg)
+	if err != nil {
+		log.Fatalf("STT provider error: %v", err)
+	}
+	log.Printf("INFO: Using speech-to-text provider: %s", transcriber.Name())
+
+	llmClient := llm.NewClient(llm.BothubChatCompletionsURL, cfg.BothubApiToken)
+	prompts, err := prompt.Load(cfg.PromptsDir, cfg.PromptPreset)
+	if err != nil {
+		log.Fatalf("Failed to load prompt templates: %v", err)
+	}
+	summarizer := summary.NewSummarizer(llmClient, cfg.ChatModel, cfg.SummaryMaxInputTokens, cfg.SummaryWorkers, prompts)
+	assistant := qa.NewAssistant(llmClient, cfg.ChatModel, cfg.SummaryMaxInputTokens, cfg.QAHistoryTokens)
+
+	repo, err := storage.Open(cfg.Database)
+	if err != nil {
+		log.Fatalf("Storage error: %v", err)
+	}
+	defer repo.Close()
+	tracker := usage.NewTracker(repo, stt.AudioModel(cfg))
+	llmClient.OnUsage(tracker.RecordTokens)
 
 	bot, err := tgbotapi.NewBotAPI(botToken)
 	if err != nil {
@@ -560,78 +511,349 @@ func main() {
 	bot.Debug = true // Установить в false для продакшена
 	log.Printf("Authorized on account %s", bot.Self.UserName)
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-
-	updates := bot.GetUpdatesChan(u)
+	// ctx отменяется по SIGINT/SIGTERM: после этого новые обновления не принимаются.
+	// jobsCtx отменяется позже, если задачи не успели завершиться за SHUTDOWN_TIMEOUT.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
+	metrics.RegisterQueue(repo)
+	metrics.RegisterTempDisk(tempFilePatterns()...)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	stopServer := serveHTTP(cfg.Addr, mux)
+
+	updates, stopUpdates, err := receiveUpdates(bot, cfg, mux)
+	if err != nil {
+		log.Fatalf("Updates receiver error: %v", err)
+	}
 	semaphore := make(chan struct{}, concurrencyLimit)
+	metrics.SemaphoreCapacity.Set(concurrencyLimit)
+	var jobs sync.WaitGroup
+
+	a := &app{
+		bot:         bot,
+		transcriber: transcriber,
+		summarizer:  summarizer,
+		sources:     source.NewRegistry(source.Builtin(), cfg.AllowedHosts),
+		prompts:     prompts,
+		assistant:   assistant,
+		repo:        repo,
+		quota:       quota.New(repo, quotaDefaults(cfg)),
+		usage:       tracker,
+	}
+	a.config.Store(cfg)
+	a.queue = queue.New(repo, cfg.QueueWorkers, a.processJob)
+	a.queue.OnFinish(a.onJobFinished)
+	a.queue.Start(ctx, jobsCtx)
+	go a.runCachePruning(ctx)
+	go a.runQuotaPruning(ctx)
+
+receiveLoop:
+	for {
+		var update tgbotapi.Update
+		select {
+		case <-ctx.Done():
+			break receiveLoop
+		case u, ok := <-updates:
+			if !ok {
+				break receiveLoop
+			}
+			update = u
+		}
+		metrics.Updates.WithLabelValues(updateType(update)).Inc()
 
-	for update := range updates {
+		if update.CallbackQuery != nil {
+			go func(query *tgbotapi.CallbackQuery) {
+				if a.authorizeCallback(query) {
+					a.handleCallbackQuery(query)
+				}
+			}(update.CallbackQuery)
+			continue
+		}
 		if update.Message == nil {
 			continue
 		}
 
+		jobs.Add(1)
 		go func(currentUpdate tgbotapi.Update) {
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
-
-			message := currentUpdate.Message
-			chatID := message.Chat.ID
-
-			if message.IsCommand() {
-				switch message.Command() {
-				case "start", "menu":
-					sendMainMenu(bot, chatID)
-				default:
-					msg := tgbotapi.NewMessage(chatID, "Неизвестная команда. Используйте /start или /menu для отображения меню.")
-					bot.Send(msg)
-				}
+			defer jobs.Done()
+			waitStart := time.Now()
+			select {
+			case semaphore <- struct{}{}:
+			case <-jobsCtx.Done():
 				return
 			}
-
-			isHandled := false
-			switch message.Text {
-			case menuCommandRecognize:
-				msg := tgbotapi.NewMessage(chatID, "Пожалуйста, отправьте мне голосовое сообщение для распознавания.")
-				bot.Send(msg)
-				isHandled = true
-			case menuCommandInfo:
-				msgText := "Я бот для обработки аудио и видео.\n"
-				msgText += "- Распознаю речь из голосовых сообщений.\n"
-				msgText += "- Предоставляю информацию о Youtube-видео (на основе аудиодорожки).\n"
-				msgText += "Используется API от bothub.chat.\n"
-				msgText += "Разработчик: Pomogalov Vladimir (доработано AI)\n"
-				msgText += "Версия: 0.2.0"
-				msg := tgbotapi.NewMessage(chatID, msgText)
-				bot.Send(msg)
-				isHandled = true
-			case menuCommandSettings:
-				msg := tgbotapi.NewMessage(chatID, "Раздел настроек пока в разработке.")
-				bot.Send(msg)
-				isHandled = true
-			case menuCommandYoutubeInfo:
-				msg := tgbotapi.NewMessage(chatID, "Пожалуйста, отправьте мне ссылку на Youtube-видео.")
-				bot.Send(msg)
-				isHandled = true
-			default:
-				if isValidYoutubeLink(message.Text) {
-					handleYoutubeVideoInfoProcessing(bot, message, cfg)
-					isHandled = true
-				}
+			metrics.ObserveSince(metrics.SemaphoreWait, waitStart)
+			metrics.SemaphoreInUse.Inc()
+			defer func() {
+				metrics.SemaphoreInUse.Dec()
+				<-semaphore
+			}()
+
+			if a.authorizeMessage(currentUpdate.Message) {
+				a.handleMessage(jobsCtx, currentUpdate.Message)
 			}
+		}(update)
+	}
 
-			if message.Voice != nil {
-				handleVoiceMessage(bot, message, cfg)
-				isHandled = true
-			}
+	log.Println("INFO: Shutting down: no longer accepting updates, waiting for running jobs...")
+	stopUpdates()
+	shutdown(func() {
+		jobs.Wait()
+		a.queue.Wait()
+		a.background.Wait()
+	}, cancelJobs, cfg.ShutdownTimeout)
+	cleanupTempFiles()
+	stopServer()
+	log.Println("INFO: Shutdown complete")
+}
+
+// shutdown ждет завершения запущенных задач не дольше timeout, затем отменяет оставшиеся
+// (yt-dlp/ffmpeg завершаются через exec.CommandContext, HTTP-запросы прерываются) и ждет их выхода
+func shutdown(wait func(), cancelJobs context.CancelFunc, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+		log.Printf("WARNING: Jobs did not finish within %s, cancelling them", timeout)
+	}
+
+	cancelJobs()
+	select {
+	case <-done:
+	case <-time.After(shutdownCancelGrace):
+		log.Println("WARNING: Some jobs did not stop after cancellation")
+	}
+}
+
+// tempFilePatterns шаблоны временных файлов и каталогов, занимающих диск во время обработки
+func tempFilePatterns() []string {
+	return []string{
+		filepath.Join(uploadDir, youtubeAudioPrefix+"*"),
+		filepath.Join(os.TempDir(), "media-*"),
+		filepath.Join(os.TempDir(), "stt-*"),
+	}
+}
+
+// cleanupTempFiles удаляет временные файлы загрузок из каталога upload
+func cleanupTempFiles() {
+	// yt-dlp оставляет рядом с файлом промежуточные .part/.webm, поэтому удаляем по общему префиксу
+	paths, err := filepath.Glob(filepath.Join(uploadDir, youtubeAudioPrefix+"*"))
+	if err != nil {
+		log.Printf("Error listing temp files in %s: %v", uploadDir, err)
+		return
+	}
+	for _, path := range paths {
+		log.Printf("Removing leftover temp file: %s", path)
+		audio.RemoveFile(path)
+	}
+}
+
+// serveHTTP запускает HTTP-сервер на APP_ADDR (/metrics, /healthz и вебхук) и возвращает функцию его остановки
+func serveHTTP(addr string, handler http.Handler) func() {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Printf("INFO: Listening for HTTP requests on %s", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("HTTP server error: %v", err)
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down HTTP server: %v", err)
+		}
+	}
+}
+
+// receiveUpdates возвращает канал обновлений в зависимости от UPDATES_MODE:
+// long polling или вебхук, который регистрируется в mux на WEBHOOK_PATH
+// Возвращаемая функция останавливает прием обновлений.
+func receiveUpdates(bot *tgbotapi.BotAPI, cfg *config.Config, mux *http.ServeMux) (tgbotapi.UpdatesChannel, func(), error) {
+	switch cfg.UpdatesMode {
+	case updatesModeWebhook:
+		if cfg.WebhookURL == "" || cfg.WebhookSecret == "" {
+			return nil, nil, fmt.Errorf("WEBHOOK_URL and WEBHOOK_SECRET must be set for webhook mode")
+		}
+		handler := webhook.NewHandler(cfg.WebhookSecret, bot.Buffer)
+		mux.Handle(cfg.WebhookPath, handler)
+		log.Printf("INFO: Listening for webhook updates on %s%s", cfg.Addr, cfg.WebhookPath)
+
+		if err := webhook.Register(bot, cfg.WebhookURL, cfg.WebhookSecret); err != nil {
+			return nil, nil, err
+		}
+		log.Printf("INFO: Webhook registered at %s", cfg.WebhookURL)
+		return handler.Updates(), handler.Stop, nil
+	case updatesModePolling, "":
+		// getUpdates не работает, пока установлен вебхук (например, после запуска в режиме webhook)
+		if _, err := bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+			log.Printf("Warning: failed to delete webhook before long polling: %v", err)
+		}
+		u := tgbotapi.NewUpdate(0)
+		u.Timeout = 60
+		return bot.GetUpdatesChan(u), bot.StopReceivingUpdates, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown UPDATES_MODE %q", cfg.UpdatesMode)
+	}
+}
+
+// rememberUser сохраняет пользователя и время его последней активности
+func (a *app) rememberUser(user *tgbotapi.User) {
+	if user == nil {
+		return
+	}
+	err := a.repo.UpsertUser(model.User{
+		ID:        user.ID,
+		UserName:  user.UserName,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+	})
+	if err != nil {
+		log.Printf("Error saving user %d: %v", user.ID, err)
+	}
+}
+
+func (a *app) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
+	switch {
+	case strings.HasPrefix(query.Data, callbackPrefixSubtitles+":"):
+		a.handleSubtitlesCallback(query)
+	case strings.HasPrefix(query.Data, callbackPrefixSettings+":"):
+		a.handleSettingsCallback(query)
+	case strings.HasPrefix(query.Data, callbackPrefixCancel+":"):
+		a.handleCancelCallback(query)
+	case strings.HasPrefix(query.Data, callbackPrefixPlaylist+":"):
+		a.handlePlaylistCallback(query)
+	default:
+		answerCallback(a.bot, query, "")
+	}
+}
 
-			if !isHandled && message.Text != "" { // Если это не команда, не кнопка, не ссылка, не голосовое
-				log.Printf("[%s] (ChatID: %d) sent unhandled text: %s", message.From.UserName, chatID, message.Text)
-				msg := tgbotapi.NewMessage(chatID, "Я не совсем понял. Может, выберете что-то из меню, отправите голосовое сообщение или ссылку на Youtube?")
+// handleMessage обрабатывает сообщение, прошедшее authorizeMessage, поэтому message.From не nil
+func (a *app) handleMessage(ctx context.Context, message *tgbotapi.Message) {
+	bot := a.bot
+	chatID := message.Chat.ID
+	a.rememberUser(message.From)
+	ctx = usage.WithOwner(ctx, message.From.ID, chatID)
+
+	if message.IsCommand() {
+		switch message.Command() {
+		case "start", "menu":
+			sendMainMenu(bot, chatID)
+		case "settings":
+			a.sendSettingsMenu(message)
+		case "cancel":
+			a.handleCancelCommand(message)
+		case "refresh":
+			a.handleRefreshCommand(message)
+		case "invite":
+			a.handleInviteCommand(message)
+		case "allowchat":
+			a.handleChatAccessCommand(message, true)
+		case "denychat":
+			a.handleChatAccessCommand(message, false)
+		case "quota":
+			a.handleQuotaCommand(message)
+		case "usage":
+			a.handleUsageCommand(message)
+		case "stats":
+			a.handleStatsCommand(message)
+		case "users":
+			a.handleUsersCommand(message)
+		case "ban":
+			a.handleBanCommand(message, true)
+		case "unban":
+			a.handleBanCommand(message, false)
+		case "broadcast":
+			a.handleBroadcastCommand(ctx, message)
+		case "jobs":
+			a.handleJobsCommand(message)
+		case "reload":
+			a.handleReloadCommand(message)
+		default:
+			msg := tgbotapi.NewMessage(chatID, "Неизвестная команда. Используйте /start или /menu для отображения меню.")
+			bot.Send(msg)
+		}
+		return
+	}
+
+	if sourceMessageID, ok := a.followUpSource(message); ok {
+		a.handleFollowUp(ctx, message, sourceMessageID)
+		return
+	}
+
+	isHandled := false
+	switch message.Text {
+	case menuCommandRecognize:
+		msg := tgbotapi.NewMessage(chatID, "Пожалуйста, отправьте мне голосовое сообщение, видеосообщение, аудио или видеофайл для распознавания.")
+		bot.Send(msg)
+		isHandled = true
+	case menuCommandInfo:
+		msgText := "Я бот для обработки аудио и видео.\n"
+		msgText += "- Распознаю речь из голосовых сообщений, видеосообщений, аудио- и видеофайлов.\n"
+		msgText += "- Отдаю транскрипт с таймкодами субтитрами .srt/.vtt.\n"
+		msgText += "- Отвечаю на вопросы по результату: ответьте на мое сообщение с вопросом.\n"
+		msgText += fmt.Sprintf("- Предоставляю информацию о видео по ссылке (%s).\n", strings.Join(a.sources.Titles(), ", "))
+		msgText += fmt.Sprintf("Распознавание речи: %s, нейросеть: API от bothub.chat.\n", a.transcriber.Name())
+		msgText += "Разработчик: Pomogalov Vladimir (доработано AI)\n"
+		msgText += "Версия: 0.2.0"
+		msg := tgbotapi.NewMessage(chatID, msgText)
+		bot.Send(msg)
+		isHandled = true
+	case menuCommandSettings:
+		a.sendSettingsMenu(message)
+		isHandled = true
+	case menuCommandYoutubeInfo:
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Пожалуйста, отправьте мне ссылку на видео (%s) или прямую ссылку на аудио- или видеофайл.", strings.Join(a.sources.Titles(), ", ")))
+		bot.Send(msg)
+		isHandled = true
+	default:
+		if request, ok, err := a.parseURLRequest(message.Text); ok {
+			if err != nil {
+				msg := tgbotapi.NewMessage(chatID, rangeHint)
 				msg.ReplyToMessageID = message.MessageID
 				bot.Send(msg)
-				sendMainMenu(bot, chatID)
+			} else {
+				a.handleURLMessage(message, request, false)
 			}
-		}(update)
+			isHandled = true
+		} else if src, playlistURL, ok := a.sources.MatchPlaylist(message.Text); ok {
+			a.handlePlaylistMessage(ctx, message, src, playlistURL)
+			isHandled = true
+		}
+	}
+
+	if media, ok := detectMedia(message); ok {
+		a.handleMediaMessage(ctx, message, media)
+		isHandled = true
+	} else if message.Document != nil {
+		log.Printf("[%s] (ChatID: %d) sent unsupported document: %s (%s)", message.From.UserName, chatID, message.Document.FileName, message.Document.MimeType)
+		msg := tgbotapi.NewMessage(chatID, "Этот файл не похож на аудио или видео. Пришлите аудиофайл, видео или голосовое сообщение.")
+		msg.ReplyToMessageID = message.MessageID
+		bot.Send(msg)
+		isHandled = true
+	}
+
+	if !isHandled && message.Text != "" { // Если это не команда, не кнопка, не ссылка, не аудио/видео
+		log.Printf("[%s] (ChatID: %d) sent unhandled text: %s", message.From.UserName, chatID, message.Text)
+		msg := tgbotapi.NewMessage(chatID, "Я не совсем понял. Может, выберете что-то из меню, отправите голосовое сообщение, аудио, видео или ссылку на видео?")
+		msg.ReplyToMessageID = message.MessageID
+		bot.Send(msg)
+		sendMainMenu(bot, chatID)
 	}
 }
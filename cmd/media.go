@@ -0,0 +1,291 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"main/internal/audio"
+	"main/internal/config"
+	"main/internal/metrics"
+	"main/internal/model"
+	"main/internal/source"
+	"main/internal/stt"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Bot API отдает на скачивание файлы не больше 20 МБ
+const maxDownloadFileSize = 20 * 1024 * 1024
+
+const (
+	mediaKindVoice     = "voice"
+	mediaKindVideoNote = "video_note"
+	mediaKindAudio     = "audio"
+	mediaKindVideo     = "video"
+	mediaKindDocument  = "document"
+)
+
+// mediaAttachment вложение сообщения, из которого можно извлечь звук
+type mediaAttachment struct {
+	kind     string
+	fileID   string
+	fileName string
+	mimeType string
+	fileSize int
+	duration int
+}
+
+// description название вложения для сообщений пользователю
+func (m *mediaAttachment) description() string {
+	switch m.kind {
+	case mediaKindVoice:
+		return "голосовое сообщение"
+	case mediaKindVideoNote:
+		return "видеосообщение"
+	case mediaKindAudio:
+		return "аудиофайл"
+	case mediaKindVideo:
+		return "видео"
+	default:
+		return "файл"
+	}
+}
+
+// extension расширение временного файла: из имени файла, иначе по MIME-типу
+func (m *mediaAttachment) extension() string {
+	if ext := filepath.Ext(m.fileName); ext != "" {
+		return strings.ToLower(ext)
+	}
+	if m.mimeType != "" {
+		if exts, err := mime.ExtensionsByType(m.mimeType); err == nil && len(exts) > 0 {
+			return exts[0]
+		}
+	}
+	switch m.kind {
+	case mediaKindVoice:
+		return ".oga"
+	case mediaKindVideoNote, mediaKindVideo:
+		return ".mp4"
+	default:
+		return ".bin"
+	}
+}
+
+// detectMedia находит во вложениях сообщения аудио или видео. Документ принимается,
+// если его MIME-тип (или, при его отсутствии, расширение файла) относится к audio/* или video/*.
+func detectMedia(message *tgbotapi.Message) (*mediaAttachment, bool) {
+	switch {
+	case message.Voice != nil:
+		v := message.Voice
+		return &mediaAttachment{kind: mediaKindVoice, fileID: v.FileID, mimeType: v.MimeType, fileSize: v.FileSize, duration: v.Duration}, true
+	case message.VideoNote != nil:
+		v := message.VideoNote
+		return &mediaAttachment{kind: mediaKindVideoNote, fileID: v.FileID, mimeType: "video/mp4", fileSize: v.FileSize, duration: v.Duration}, true
+	case message.Audio != nil:
+		v := message.Audio
+		return &mediaAttachment{kind: mediaKindAudio, fileID: v.FileID, fileName: v.FileName, mimeType: v.MimeType, fileSize: v.FileSize, duration: v.Duration}, true
+	case message.Video != nil:
+		v := message.Video
+		return &mediaAttachment{kind: mediaKindVideo, fileID: v.FileID, fileName: v.FileName, mimeType: v.MimeType, fileSize: v.FileSize, duration: v.Duration}, true
+	case message.Document != nil:
+		v := message.Document
+		mimeType := v.MimeType
+		if mimeType == "" || mimeType == "application/octet-stream" {
+			mimeType = mime.TypeByExtension(strings.ToLower(filepath.Ext(v.FileName)))
+		}
+		if !isMediaMimeType(mimeType) {
+			return nil, false
+		}
+		return &mediaAttachment{kind: mediaKindDocument, fileID: v.FileID, fileName: v.FileName, mimeType: mimeType, fileSize: v.FileSize}, true
+	}
+	return nil, false
+}
+
+func isMediaMimeType(mimeType string) bool {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	return strings.HasPrefix(mimeType, "audio/") || strings.HasPrefix(mimeType, "video/")
+}
+
+// handleMediaMessage скачивает вложение, извлекает из него звуковую дорожку и распознает речь
+func (a *app) handleMediaMessage(ctx context.Context, message *tgbotapi.Message, media *mediaAttachment) {
+	bot := a.bot
+	chatID := message.Chat.ID
+	settings := a.userSettings(message.From.ID)
+
+	log.Printf("[%s] (ChatID: %d) sent %s (FileID: %s, MIME: %s, Size: %d, Duration: %d)",
+		message.From.UserName, chatID, media.kind, media.fileID, media.mimeType, media.fileSize, media.duration)
+
+	if media.fileSize > maxDownloadFileSize {
+		sendOrEditMessage(bot, chatID, 0, fmt.Sprintf("Файл слишком большой: Telegram позволяет ботам скачивать файлы до %d МБ.", maxDownloadFileSize/1024/1024), message.MessageID)
+		return
+	}
+
+	// Длительность известна до скачивания для голосовых, видеосообщений и большинства аудио и видео
+	if text := a.audioQuotaText(message.From.ID, float64(media.duration)); text != "" {
+		sendOrEditMessage(bot, chatID, 0, text, message.MessageID)
+		return
+	}
+
+	inputTempFile, err := os.CreateTemp("", "media-*"+media.extension())
+	if err != nil {
+		log.Printf("Error creating temp media file: %v", err)
+		bot.Send(tgbotapi.NewMessage(chatID, "Ошибка сервера: не удалось создать временный файл для аудио."))
+		return
+	}
+	inputFilePath := inputTempFile.Name()
+	inputTempFile.Close()
+	defer func() {
+		log.Printf("Attempting to remove media file: %s", inputFilePath)
+		if err := os.Remove(inputFilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing temp media file %s: %v", inputFilePath, err)
+		}
+	}()
+
+	start := time.Now()
+	err = downloadFile(ctx, bot, media.fileID, inputFilePath)
+	metrics.ObserveSince(metrics.DownloadDuration.WithLabelValues("telegram", metrics.Result(err)), start)
+	if err != nil {
+		log.Printf("Error downloading %s file (ID: %s): %v", media.kind, media.fileID, err)
+		bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Не удалось скачать %s.", media.description())))
+		return
+	}
+
+	wavTempFile, err := os.CreateTemp("", "media-*.wav")
+	if err != nil {
+		log.Printf("Error creating temp wav file: %v", err)
+		bot.Send(tgbotapi.NewMessage(chatID, "Ошибка сервера: не удалось создать временный файл для конвертации."))
+		return
+	}
+	wavFilePath := wavTempFile.Name()
+	wavTempFile.Close()
+	defer func() {
+		log.Printf("Attempting to remove wav file: %s", wavFilePath)
+		if err := os.Remove(wavFilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing temp wav file %s: %v", wavFilePath, err)
+		}
+	}()
+
+	// ffmpeg берет звуковую дорожку и из аудио, и из видео
+	err = audio.ConvertToWav(ctx, inputFilePath, wavFilePath)
+	if err != nil {
+		log.Printf("Error converting audio from %s to %s: %v", inputFilePath, wavFilePath, err)
+		bot.Send(tgbotapi.NewMessage(chatID, "Ошибка конвертации аудио: возможно, в файле нет звуковой дорожки."))
+		return
+	}
+	duration := float64(media.duration)
+	if duration == 0 {
+		// У документов Telegram не сообщает длительность - проверяем квоту по самому файлу
+		if duration, err = audio.Duration(ctx, wavFilePath); err != nil {
+			log.Printf("Error measuring duration of %s: %v", wavFilePath, err)
+		} else if text := a.audioQuotaText(message.From.ID, duration); text != "" {
+			sendOrEditMessage(bot, chatID, 0, text, message.MessageID)
+			return
+		}
+	}
+
+	transcript, err := a.transcriber.Transcribe(ctx, wavFilePath, stt.Options{Language: settings.TranscriptionLanguage})
+	if err != nil {
+		log.Printf("Error recognizing speech for file %s: %v", wavFilePath, err)
+		bot.Send(tgbotapi.NewMessage(chatID, "Не удалось распознать речь."))
+		return
+	}
+	a.recordTranscription(ctx, message.From.ID, cmp.Or(transcript.Duration, duration))
+
+	if transcript.Text == "" {
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Не удалось извлечь текст (%s, результат пуст).", media.description()))
+		msg.ReplyToMessageID = message.MessageID
+		bot.Send(msg)
+		return
+	}
+	a.saveTranscript(chatID, message.MessageID, message.From.ID, media.kind, transcript)
+
+	if settings.OutputFormat == model.OutputFormatFile {
+		messageID := a.sendResultDocument(chatID, message.MessageID, fmt.Sprintf("transcript_%d", message.MessageID), transcript.Text, nil)
+		a.linkResult(chatID, message.MessageID, messageID)
+		a.offerSubtitles(chatID, message.MessageID, transcript)
+		return
+	}
+
+	var markup *tgbotapi.InlineKeyboardMarkup
+	if len(transcript.Segments) > 0 {
+		keyboard := subtitlesKeyboard(message.MessageID)
+		markup = &keyboard
+	}
+	messageIDs := a.deliverText(chatID, 0, message.MessageID, transcript.Text, fmt.Sprintf("transcript_%d", message.MessageID), markup)
+	a.linkResult(chatID, message.MessageID, messageIDs...)
+}
+
+// downloadDirectAudio скачивает медиафайл по прямой ссылке и перекодирует звук в mp3 для распознавания;
+// если задан диапазон, в mp3 попадает только он
+func downloadDirectAudio(ctx context.Context, sources *source.Registry, fileURL string, cfg *config.Config, timeRange source.TimeRange) (string, error) {
+	inputTempFile, err := os.CreateTemp(uploadDir, youtubeAudioPrefix+"direct_*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file for direct download: %w", err)
+	}
+	inputPath := inputTempFile.Name()
+	inputTempFile.Close()
+	defer os.Remove(inputPath)
+
+	log.Printf("Downloading media file from URL: %s to %s", fileURL, inputPath)
+	start := time.Now()
+	err = sources.Download(ctx, fileURL, inputPath, cfg.DirectMaxBytes)
+	metrics.ObserveSince(metrics.DownloadDuration.WithLabelValues("direct", metrics.Result(err)), start)
+	if err != nil {
+		return "", err
+	}
+
+	mp3TempFile, err := os.CreateTemp(uploadDir, youtubeAudioPattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file for direct audio: %w", err)
+	}
+	mp3FilePath := mp3TempFile.Name()
+	mp3TempFile.Close()
+
+	if timeRange.IsZero() {
+		err = audio.ConvertToMP3(ctx, inputPath, mp3FilePath)
+	} else {
+		err = extractRange(ctx, inputPath, mp3FilePath, timeRange)
+	}
+	if err != nil {
+		os.Remove(mp3FilePath)
+		return "", err
+	}
+	return mp3FilePath, nil
+}
+
+// extractRange вырезает фрагмент из файла; для фрагмента до конца длина считается по длительности файла
+func extractRange(ctx context.Context, inputPath, mp3Path string, timeRange source.TimeRange) error {
+	end := timeRange.End
+	if end <= 0 {
+		duration, err := audio.Duration(ctx, inputPath)
+		if err != nil {
+			return err
+		}
+		end = duration
+	}
+	if end <= timeRange.Start {
+		return fmt.Errorf("time range starts after the end of the file")
+	}
+	return audio.Extract(ctx, inputPath, mp3Path, timeRange.Start, end-timeRange.Start)
+}
+
+// directFileTitle имя файла из прямой ссылки, используется вместо названия видео; для остальных ссылок пусто
+func directFileTitle(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	name, err := url.PathUnescape(path.Base(u.Path))
+	if err != nil || name == "/" || name == "." || filepath.Ext(name) == "" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,30 @@
+package main
+
+import tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+// updateType тип обновления для метрики updates_total
+func updateType(update tgbotapi.Update) string {
+	message := update.Message
+	switch {
+	case update.CallbackQuery != nil:
+		return "callback_query"
+	case message == nil:
+		return "other"
+	case message.IsCommand():
+		return "command"
+	case message.Voice != nil:
+		return "voice"
+	case message.Audio != nil:
+		return "audio"
+	case message.Video != nil:
+		return "video"
+	case message.VideoNote != nil:
+		return "video_note"
+	case message.Document != nil:
+		return "document"
+	case message.Text != "":
+		return "text"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"main/internal/model"
+	"main/internal/quota"
+	"main/internal/source"
+	"main/internal/summary"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	callbackPrefixPlaylist = "pl"
+
+	playlistActionRun    = "run"
+	playlistActionDigest = "digest"
+	playlistActionCancel = "cancel"
+)
+
+// playlistKeyboard подтверждение пакетной обработки плейлиста
+func playlistKeyboard(batchID int64) *tgbotapi.InlineKeyboardMarkup {
+	data := func(action string) string {
+		return callbackPrefixPlaylist + ":" + strconv.FormatInt(batchID, 10) + ":" + action
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("▶️ Обработать", data(playlistActionRun)),
+			tgbotapi.NewInlineKeyboardButtonData("📋 + общий дайджест", data(playlistActionDigest)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✖️ Отмена", data(playlistActionCancel)),
+		),
+	)
+	return &keyboard
+}
+
+// handlePlaylistMessage перечисляет видео плейлиста и предлагает обработать их пакетом
+func (a *app) handlePlaylistMessage(ctx context.Context, message *tgbotapi.Message, src *source.Source, playlistURL string) {
+	chatID := message.Chat.ID
+	if a.cfg().PlaylistMaxVideos <= 0 {
+		msg := tgbotapi.NewMessage(chatID, "Обработка плейлистов и каналов отключена. Пришлите ссылку на отдельное видео.")
+		msg.ReplyToMessageID = message.MessageID
+		a.bot.Send(msg)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "Получаю список видео плейлиста...")
+	msg.ReplyToMessageID = message.MessageID
+	sentMsg, err := a.bot.Send(msg)
+	if err != nil {
+		log.Printf("Error sending playlist message: %v", err)
+	}
+
+	title, entries, err := fetchPlaylist(ctx, playlistURL, src, a.cfg(), a.cfg().PlaylistMaxVideos)
+	if err != nil {
+		log.Printf("Error listing playlist %s: %v", playlistURL, err)
+		sendOrEditMessage(a.bot, chatID, sentMsg.MessageID, failureText(ctx, "Не удалось получить список видео плейлиста", err), message.MessageID)
+		return
+	}
+	entries = a.playlistEntries(entries)
+	if len(entries) == 0 {
+		sendOrEditMessage(a.bot, chatID, sentMsg.MessageID, "В плейлисте нет видео, которые я могу обработать.", message.MessageID)
+		return
+	}
+
+	batch := &model.Batch{
+		ChatID:            chatID,
+		MessageID:         message.MessageID,
+		ProgressMessageID: sentMsg.MessageID,
+		Source:            playlistURL,
+		Title:             title,
+		Entries:           entries,
+		Status:            model.BatchStatusPending,
+		UserID:            message.From.ID,
+	}
+	if err := a.repo.CreateBatch(batch); err != nil {
+		log.Printf("Error creating batch for %s: %v", playlistURL, err)
+		sendOrEditMessage(a.bot, chatID, sentMsg.MessageID, "Не удалось сохранить плейлист, попробуйте позже.", message.MessageID)
+		return
+	}
+
+	text := fmt.Sprintf("%s: видео - %d", playlistTitle(batch), len(entries))
+	if len(entries) >= a.cfg().PlaylistMaxVideos {
+		text += fmt.Sprintf(" (обрабатываются только первые %d)", a.cfg().PlaylistMaxVideos)
+	}
+	text += ".\nОбработать каждое видео отдельно? Результаты придут отдельными сообщениями, по желанию - с общим дайджестом плейлиста."
+	sendOrEditMessageWithMarkup(a.bot, chatID, sentMsg.MessageID, text, message.MessageID, playlistKeyboard(batch.ID))
+}
+
+// playlistEntries оставляет видео, ссылки на которые бот принимает, без повторов
+func (a *app) playlistEntries(entries []model.BatchEntry) []model.BatchEntry {
+	var result []model.BatchEntry
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		src, u, ok := a.sources.Match(entry.URL)
+		if !ok || src.Direct {
+			continue
+		}
+		videoID := src.VideoID(u)
+		if seen[videoID] {
+			continue
+		}
+		seen[videoID] = true
+		entry.URL = u.String()
+		result = append(result, entry)
+		if len(result) == a.cfg().PlaylistMaxVideos {
+			break
+		}
+	}
+	return result
+}
+
+func playlistTitle(batch *model.Batch) string {
+	if batch.Title == "" {
+		return "📃 Плейлист"
+	}
+	return "📃 Плейлист «" + batch.Title + "»"
+}
+
+// handlePlaylistCallback обрабатывает кнопки pl:<batchID>:<action>
+func (a *app) handlePlaylistCallback(query *tgbotapi.CallbackQuery) {
+	parts := strings.Split(strings.TrimPrefix(query.Data, callbackPrefixPlaylist+":"), ":")
+	if len(parts) != 2 {
+		answerCallback(a.bot, query, "Некорректный запрос.")
+		return
+	}
+	batchID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		answerCallback(a.bot, query, "Некорректный запрос.")
+		return
+	}
+	action := parts[1]
+
+	batch, err := a.repo.GetBatch(batchID)
+	if err != nil {
+		log.Printf("Error loading batch %d: %v", batchID, err)
+		answerCallback(a.bot, query, "Плейлист не найден.")
+		return
+	}
+	if batch.UserID != query.From.ID {
+		answerCallback(a.bot, query, "Запустить обработку может только тот, кто прислал ссылку.")
+		return
+	}
+
+	next := model.BatchStatusQueueing
+	if action == playlistActionCancel {
+		next = model.BatchStatusCancelled
+	}
+	// Каждое видео плейлиста расходует квоту на ссылки: квота списывается сразу, и в очередь ставится столько видео,
+	// сколько удалось списать
+	total := len(batch.Entries)
+	reserved, reservedAt := 0, time.Now()
+	if next == model.BatchStatusQueueing {
+		var status quota.Status
+		reserved, status = a.reserveSummaries(query.From.ID, total)
+		if reserved == 0 {
+			answerCallback(a.bot, query, summaryQuotaText(status))
+			return
+		}
+		batch.Entries = batch.Entries[:reserved]
+	}
+	release := func() {
+		for range reserved {
+			a.releaseSummary(query.From.ID, reservedAt)
+		}
+	}
+	// Условный переход защищает от повторного нажатия и нажатия в нескольких репликах
+	ok, err := a.repo.SetBatchStatus(batchID, model.BatchStatusPending, next)
+	if err != nil {
+		log.Printf("Error updating batch %d: %v", batchID, err)
+		release()
+		answerCallback(a.bot, query, "Не удалось запустить обработку.")
+		return
+	}
+	if !ok {
+		release()
+		answerCallback(a.bot, query, "Плейлист уже обрабатывается.")
+		return
+	}
+	answerCallback(a.bot, query, "")
+
+	if action == playlistActionCancel {
+		sendOrEditMessage(a.bot, batch.ChatID, batch.ProgressMessageID, playlistTitle(batch)+": обработка отменена.", 0)
+		return
+	}
+	if len(batch.Entries) < total {
+		text := fmt.Sprintf("Лимит обработки ссылок: из %d видео плейлиста в очередь поставлены первые %d. Проверить остаток - /quota.",
+			total, len(batch.Entries))
+		a.bot.Send(tgbotapi.NewMessage(batch.ChatID, text))
+	}
+	batch.Digest = action == playlistActionDigest
+	batch.Status = model.BatchStatusQueueing
+	if err := a.repo.UpdateBatch(batch); err != nil {
+		log.Printf("Error updating batch %d: %v", batchID, err)
+	}
+	a.enqueueBatch(batch, reservedAt)
+}
+
+// enqueueBatch ставит в очередь задачу на каждое видео плейлиста; квота за видео уже списана в момент reservedAt.
+// Пакет переводится в running только после этого, чтобы быстро завершившиеся задачи не сочли пакет
+// выполненным раньше времени.
+func (a *app) enqueueBatch(batch *model.Batch, reservedAt time.Time) {
+	for i, entry := range batch.Entries {
+		text := fmt.Sprintf("Видео %d из %d", i+1, len(batch.Entries))
+		if entry.Title != "" {
+			text += " «" + entry.Title + "»"
+		}
+		progressMsg := tgbotapi.NewMessage(batch.ChatID, text+": в очереди на обработку.")
+		progressMsg.ReplyToMessageID = batch.MessageID
+		sentMsg, err := a.bot.Send(progressMsg)
+		if err != nil {
+			log.Printf("Error sending progress message for batch %d: %v", batch.ID, err)
+		}
+
+		job := &model.Job{
+			UserID:            batch.UserID,
+			ChatID:            batch.ChatID,
+			MessageID:         batch.MessageID,
+			ProgressMessageID: sentMsg.MessageID,
+			Kind:              model.JobKindURL,
+			Source:            entry.URL,
+			BatchID:           batch.ID,
+			CreatedAt:         reservedAt, // по нему возвращается квота, если задача не выполнится
+		}
+		if err := a.queue.Enqueue(job); err != nil {
+			log.Printf("Error enqueueing job for %s (batch %d): %v", entry.URL, batch.ID, err)
+			a.releaseSummary(job.UserID, reservedAt)
+			sendOrEditMessage(a.bot, batch.ChatID, sentMsg.MessageID, text+": не удалось поставить в очередь.", batch.MessageID)
+			continue
+		}
+		if sentMsg.MessageID != 0 {
+			if _, err := a.bot.Request(tgbotapi.NewEditMessageReplyMarkup(batch.ChatID, sentMsg.MessageID, *cancelKeyboard(job.ID))); err != nil {
+				log.Printf("Error adding cancel button for job %d: %v", job.ID, err)
+			}
+		}
+	}
+
+	if _, err := a.repo.SetBatchStatus(batch.ID, model.BatchStatusQueueing, model.BatchStatusRunning); err != nil {
+		log.Printf("Error starting batch %d: %v", batch.ID, err)
+		return
+	}
+	a.updateBatchProgress(batch.ID)
+}
+
+// onJobFinished вызывается очередью после завершения задачи: возвращает квоту за невыполненную ссылку
+// и обновляет прогресс плейлиста
+func (a *app) onJobFinished(job *model.Job) {
+	if job.Kind == model.JobKindURL && (job.Status == model.JobStatusFailed || job.Status == model.JobStatusCancelled) {
+		// Квота списана при постановке в очередь, в окне времени создания задачи
+		a.releaseSummary(job.UserID, job.CreatedAt)
+	}
+	if job.BatchID == 0 || job.Kind == model.JobKindDigest {
+		return
+	}
+	a.updateBatchProgress(job.BatchID)
+}
+
+// updateBatchProgress показывает общий прогресс плейлиста. Когда все видео обработаны, пакет завершается
+// (ровно один раз, даже если последние задачи закончились одновременно) и при необходимости ставится дайджест.
+func (a *app) updateBatchProgress(batchID int64) {
+	batch, err := a.repo.GetBatch(batchID)
+	if err != nil {
+		log.Printf("Error loading batch %d: %v", batchID, err)
+		return
+	}
+	if batch.Status != model.BatchStatusRunning {
+		return
+	}
+	jobs, err := a.repo.ListBatchJobs(batchID)
+	if err != nil {
+		log.Printf("Error loading jobs of batch %d: %v", batchID, err)
+		return
+	}
+
+	var done, failed, cancelled, pending int
+	for _, job := range jobs {
+		if job.Kind == model.JobKindDigest {
+			continue
+		}
+		switch job.Status {
+		case model.JobStatusDone:
+			done++
+		case model.JobStatusFailed:
+			failed++
+		case model.JobStatusCancelled:
+			cancelled++
+		default:
+			pending++
+		}
+	}
+
+	text := fmt.Sprintf("%s: видео - %d\n✅ Готово: %d · ❌ Ошибок: %d · ⏹ Отменено: %d · ⏳ В работе: %d",
+		playlistTitle(batch), done+failed+cancelled+pending, done, failed, cancelled, pending)
+	if pending > 0 {
+		sendOrEditMessage(a.bot, batch.ChatID, batch.ProgressMessageID, text, batch.MessageID)
+		return
+	}
+
+	finished, err := a.repo.SetBatchStatus(batchID, model.BatchStatusRunning, model.BatchStatusDone)
+	if err != nil || !finished {
+		if err != nil {
+			log.Printf("Error finishing batch %d: %v", batchID, err)
+		}
+		return
+	}
+	text += "\nОбработка плейлиста завершена."
+	if batch.Digest && done > 0 {
+		text += " Составляю общий дайджест..."
+	}
+	sendOrEditMessage(a.bot, batch.ChatID, batch.ProgressMessageID, text, batch.MessageID)
+	if batch.Digest && done > 0 {
+		a.enqueueDigest(batch)
+	}
+}
+
+func (a *app) enqueueDigest(batch *model.Batch) {
+	progressMsg := tgbotapi.NewMessage(batch.ChatID, playlistTitle(batch)+": дайджест в очереди.")
+	progressMsg.ReplyToMessageID = batch.MessageID
+	sentMsg, err := a.bot.Send(progressMsg)
+	if err != nil {
+		log.Printf("Error sending digest message for batch %d: %v", batch.ID, err)
+	}
+	job := &model.Job{
+		UserID:            batch.UserID,
+		ChatID:            batch.ChatID,
+		MessageID:         batch.MessageID,
+		ProgressMessageID: sentMsg.MessageID,
+		Kind:              model.JobKindDigest,
+		Source:            batch.Source,
+		BatchID:           batch.ID,
+	}
+	if err := a.queue.Enqueue(job); err != nil {
+		log.Printf("Error enqueueing digest for batch %d: %v", batch.ID, err)
+		sendOrEditMessage(a.bot, batch.ChatID, sentMsg.MessageID, "Не удалось поставить дайджест в очередь.", batch.MessageID)
+	}
+}
+
+// processDigestJob составляет общий дайджест плейлиста по результатам его видео
+func (a *app) processDigestJob(ctx context.Context, job *model.Job) error {
+	batch, err := a.repo.GetBatch(job.BatchID)
+	if err != nil {
+		return fmt.Errorf("failed to load batch %d: %w", job.BatchID, err)
+	}
+	jobs, err := a.repo.ListBatchJobs(batch.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load jobs of batch %d: %w", batch.ID, err)
+	}
+
+	var items []summary.DigestItem
+	for _, videoJob := range jobs {
+		if videoJob.Kind == model.JobKindDigest || videoJob.Status != model.JobStatusDone || videoJob.Result == "" {
+			continue
+		}
+		item := summary.DigestItem{Summary: videoJob.Result}
+		if i := slices.IndexFunc(batch.Entries, func(entry model.BatchEntry) bool { return entry.URL == videoJob.Source }); i >= 0 {
+			item.Title = batch.Entries[i].Title
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		sendOrEditMessage(a.bot, job.ChatID, job.ProgressMessageID, "Нет обработанных видео для дайджеста.", job.MessageID)
+		return errors.New("no finished videos for digest")
+	}
+
+	if err := a.queue.SetStatus(job, model.JobStatusSummarizing); err != nil {
+		log.Printf("Error updating job %d status: %v", job.ID, err)
+	}
+	sendOrEditMessageWithMarkup(a.bot, job.ChatID, job.ProgressMessageID,
+		fmt.Sprintf("%s: составляю дайджест по %d видео...", playlistTitle(batch), len(items)), 0, cancelKeyboard(job.ID))
+
+	settings := a.userSettings(job.UserID)
+	digest, err := a.summarizer.Digest(ctx, items, summary.Options{
+		Model:    settings.ChatModel,
+		Language: settings.SummaryLanguage,
+		Style:    settings.SummaryStyle,
+		Preset:   settings.PromptPreset,
+		Title:    batch.Title,
+	})
+	if err != nil {
+		log.Printf("Error building digest for batch %d: %v", batch.ID, err)
+		sendOrEditMessage(a.bot, job.ChatID, job.ProgressMessageID, failureText(ctx, "Не удалось составить дайджест плейлиста", err), job.MessageID)
+		return fmt.Errorf("failed to build digest: %w", err)
+	}
+
+	job.Result = digest
+	finalReply := fmt.Sprintf("%s - дайджест по %d видео:\n\n%s", playlistTitle(batch), len(items), digest)
+	a.deliverText(job.ChatID, job.ProgressMessageID, job.MessageID, finalReply, fmt.Sprintf("digest_%d", batch.ID), nil)
+	return nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"main/internal/model"
+	"main/internal/quota"
+	"main/internal/summary"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const quotaPruneInterval = time.Hour
+
+// quotaLimits действующие лимиты пользователя; false - квоты к нему не применяются (администратор)
+func (a *app) quotaLimits(userID int64) (model.QuotaLimits, bool) {
+	if a.isAdmin(userID) {
+		return model.QuotaLimits{}, false
+	}
+	limits, _, err := a.quota.Limits(userID)
+	if err != nil {
+		// Ошибка хранилища не должна блокировать работу: действуют лимиты по умолчанию
+		log.Printf("Error loading quota limits for user %d: %v", userID, err)
+	}
+	return limits, true
+}
+
+// reserveSummaries списывает с квоты пользователя до n ссылок перед постановкой в очередь и возвращает,
+// сколько удалось списать, и состояние квоты, если ее не хватило. Расход учитывается и без ограничения,
+// чтобы его можно было вернуть, если задача не выполнится.
+func (a *app) reserveSummaries(userID int64, n int) (int, quota.Status) {
+	limits, _ := a.quotaLimits(userID)
+	for i := 0; i < n; i++ {
+		ok, err := a.quota.Reserve(userID, model.QuotaUsageSummary, 1, float64(limits.SummariesPerHour))
+		if err != nil {
+			// Ошибка хранилища не должна блокировать работу
+			log.Printf("Error reserving summary quota for user %d: %v", userID, err)
+			continue
+		}
+		if !ok {
+			status, err := a.quota.Summaries(userID, limits)
+			if err != nil {
+				log.Printf("Error loading summary quota for user %d: %v", userID, err)
+			}
+			return i, status
+		}
+	}
+	return n, quota.Status{}
+}
+
+// releaseSummary возвращает в квоту ссылку, списанную в момент at: задачу не удалось поставить в очередь,
+// она завершилась ошибкой или ее отменили
+func (a *app) releaseSummary(userID int64, at time.Time) {
+	if err := a.quota.Release(userID, model.QuotaUsageSummary, at, 1); err != nil {
+		log.Printf("Error releasing summary quota for user %d: %v", userID, err)
+	}
+}
+
+func summaryQuotaText(status quota.Status) string {
+	return fmt.Sprintf("Лимит обработки ссылок исчерпан: %.0f в час. Новые ссылки можно отправить после %s.",
+		status.Limit, formatResetTime(status.ResetAt))
+}
+
+// durationLimitText текст отказа, если файл или видео длиннее допустимого для пользователя; пустая строка - можно
+func (a *app) durationLimitText(userID int64, seconds float64) string {
+	limits, ok := a.quotaLimits(userID)
+	if !ok || limits.MaxDurationMinutes <= 0 || seconds <= float64(limits.MaxDurationMinutes)*60 {
+		return ""
+	}
+	return fmt.Sprintf("Слишком длинная запись (%s): можно обрабатывать файлы и видео до %d мин. Отправьте фрагмент покороче.",
+		summary.FormatTimestamp(seconds), limits.MaxDurationMinutes)
+}
+
+// audioQuotaText текст отказа, если у пользователя не хватает дневной квоты на распознавание seconds секунд
+// аудио (0 - длительность неизвестна, тогда проверяется только, что квота не исчерпана); пустая строка - можно
+func (a *app) audioQuotaText(userID int64, seconds float64) string {
+	if text := a.durationLimitText(userID, seconds); text != "" {
+		return text
+	}
+	limits, ok := a.quotaLimits(userID)
+	if !ok || limits.AudioMinutesPerDay <= 0 {
+		return ""
+	}
+	status, err := a.quota.Audio(userID, limits)
+	if err != nil {
+		log.Printf("Error loading audio quota for user %d: %v", userID, err)
+		return ""
+	}
+	if status.Remaining() <= 0 {
+		return fmt.Sprintf("Дневной лимит распознавания аудио исчерпан (%d мин в сутки). Лимит обновится в %s.",
+			limits.AudioMinutesPerDay, formatResetTime(status.ResetAt))
+	}
+	if !status.Allows(seconds) {
+		return fmt.Sprintf("Не хватает дневного лимита распознавания: запись длится %s, осталось %s (лимит обновится в %s).",
+			summary.FormatTimestamp(seconds), formatMinutes(status.Remaining()), formatResetTime(status.ResetAt))
+	}
+	return ""
+}
+
+// recordUsage записывает расход квоты; ошибка только логируется, результат пользователь уже получил
+func (a *app) recordUsage(userID int64, kind string, amount float64) {
+	if err := a.quota.Record(userID, kind, amount); err != nil {
+		log.Printf("Error recording %s usage for user %d: %v", kind, userID, err)
+	}
+}
+
+// handleQuotaCommand показывает пользователю остаток его квот. Администратор может посмотреть и изменить
+// квоты другого пользователя: /quota <id>, /quota <id> <мин аудио в сутки> <ссылок в час> <макс. мин>, /quota <id> default
+func (a *app) handleQuotaCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		a.bot.Send(tgbotapi.NewMessage(chatID, a.quotaReport(message.From.ID, "Ваши квоты")))
+		return
+	}
+	if !a.requireAdmin(message) {
+		return
+	}
+
+	usage := "Использование: /quota <id>, /quota <id> <мин аудио в сутки> <ссылок в час> <макс. длительность, мин> или /quota <id> default. 0 - без ограничения."
+	userID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		a.bot.Send(tgbotapi.NewMessage(chatID, usage))
+		return
+	}
+	switch {
+	case len(args) == 1:
+	case len(args) == 2 && args[1] == "default":
+		if err := a.repo.DeleteQuotaLimits(userID); err != nil {
+			log.Printf("Error resetting quota limits for user %d: %v", userID, err)
+			a.bot.Send(tgbotapi.NewMessage(chatID, "Не удалось сбросить квоты."))
+			return
+		}
+		log.Printf("Admin %d reset quota limits for user %d", message.From.ID, userID)
+	case len(args) == 4:
+		values := make([]int, 3)
+		for i, arg := range args[1:] {
+			values[i], err = strconv.Atoi(arg)
+			if err != nil || values[i] < 0 {
+				a.bot.Send(tgbotapi.NewMessage(chatID, usage))
+				return
+			}
+		}
+		limits := model.QuotaLimits{AudioMinutesPerDay: values[0], SummariesPerHour: values[1], MaxDurationMinutes: values[2]}
+		if err := a.repo.SetQuotaLimits(userID, limits); err != nil {
+			log.Printf("Error setting quota limits for user %d: %v", userID, err)
+			a.bot.Send(tgbotapi.NewMessage(chatID, "Не удалось изменить квоты."))
+			return
+		}
+		log.Printf("Admin %d set quota limits for user %d: %+v", message.From.ID, userID, limits)
+	default:
+		a.bot.Send(tgbotapi.NewMessage(chatID, usage))
+		return
+	}
+	a.bot.Send(tgbotapi.NewMessage(chatID, a.quotaReport(userID, fmt.Sprintf("Квоты пользователя %d", userID))))
+}
+
+// quotaReport описание квот пользователя: остаток, лимит и время сброса
+func (a *app) quotaReport(userID int64, heading string) string {
+	if a.isAdmin(userID) {
+		return heading + ": без ограничений (администратор)."
+	}
+	limits, custom, err := a.quota.Limits(userID)
+	if err != nil {
+		log.Printf("Error loading quota limits for user %d: %v", userID, err)
+	}
+	if custom {
+		heading += " (назначены администратором)"
+	}
+	lines := []string{heading + ":"}
+
+	audioLine := "Распознавание аудио: без ограничений"
+	if limits.AudioMinutesPerDay > 0 {
+		status, err := a.quota.Audio(userID, limits)
+		if err != nil {
+			log.Printf("Error loading audio quota for user %d: %v", userID, err)
+		}
+		audioLine = fmt.Sprintf("Распознавание аудио: осталось %s из %d мин в сутки, обновится в %s",
+			formatMinutes(status.Remaining()), limits.AudioMinutesPerDay, formatResetTime(status.ResetAt))
+	}
+	lines = append(lines, audioLine)
+
+	summaryLine := "Обработка ссылок: без ограничений"
+	if limits.SummariesPerHour > 0 {
+		status, err := a.quota.Summaries(userID, limits)
+		if err != nil {
+			log.Printf("Error loading summary quota for user %d: %v", userID, err)
+		}
+		summaryLine = fmt.Sprintf("Обработка ссылок: осталось %.0f из %d в час, обновится в %s",
+			status.Remaining(), limits.SummariesPerHour, formatResetTime(status.ResetAt))
+	}
+	lines = append(lines, summaryLine)
+
+	durationLine := "Длительность одной записи: без ограничений"
+	if limits.MaxDurationMinutes > 0 {
+		durationLine = fmt.Sprintf("Длительность одной записи: до %d мин", limits.MaxDurationMinutes)
+	}
+	lines = append(lines, durationLine)
+	return strings.Join(lines, "\n")
+}
+
+// runQuotaPruning периодически удаляет записи о расходе квот, вышедшие из всех окон
+func (a *app) runQuotaPruning(ctx context.Context) {
+	ticker := time.NewTicker(quotaPruneInterval)
+	defer ticker.Stop()
+	for {
+		deleted, err := a.quota.Prune()
+		if err != nil {
+			log.Printf("Error pruning quota usage: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Pruned %d quota usage records", deleted)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func formatMinutes(seconds float64) string {
+	return fmt.Sprintf("%.0f мин", seconds/60)
+}
+
+func formatResetTime(t time.Time) string {
+	now := time.Now().In(t.Location())
+	if t.Year() == now.Year() && t.YearDay() == now.YearDay() {
+		return t.Format("15:04")
+	}
+	return t.Format("15:04 02.01")
+}
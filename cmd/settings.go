@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"main/internal/model"
+	"main/internal/summary"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	callbackPrefixSettings = "set"
+
+	// Значение кнопки "по умолчанию": в настройках хранится пустой строкой
+	settingValueDefault = "default"
+
+	settingTranscriptionLanguage = "stt_lang"
+	settingSummaryLanguage       = "sum_lang"
+	settingSummaryStyle          = "style"
+	settingPromptPreset          = "preset"
+	settingOutputFormat          = "output"
+	settingChatModel             = "model"
+)
+
+type settingOption struct {
+	value string
+	label string
+}
+
+// settingDefinition описывает один пункт меню настроек
+type settingDefinition struct {
+	key     string
+	title   string
+	options []settingOption
+	get     func(s *model.UserSettings) *string
+}
+
+func (a *app) settingDefinitions() []settingDefinition {
+	modelOptions := []settingOption{{settingValueDefault, a.cfg().ChatModel + " (по умолчанию)"}}
+	for _, name := range a.cfg().ChatModels {
+		if name != a.cfg().ChatModel {
+			modelOptions = append(modelOptions, settingOption{name, name})
+		}
+	}
+
+	presetOptions := []settingOption{{settingValueDefault, a.prompts.Default().Title + " (по умолчанию)"}}
+	for _, preset := range a.prompts.Presets()[1:] {
+		presetOptions = append(presetOptions, settingOption{preset.Name, preset.Title})
+	}
+
+	return []settingDefinition{
+		{
+			key:   settingTranscriptionLanguage,
+			title: "Язык распознавания",
+			options: []settingOption{
+				{settingValueDefault, "Автоопределение"},
+				{"ru", "Русский"},
+				{"en", "English"},
+				{"uk", "Українська"},
+				{"de", "Deutsch"},
+				{"fr", "Français"},
+				{"es", "Español"},
+			},
+			get: func(s *model.UserSettings) *string { return &s.TranscriptionLanguage },
+		},
+		{
+			key:   settingSummaryLanguage,
+			title: "Язык краткого содержания",
+			options: []settingOption{
+				{settingValueDefault, "Русский"},
+				{"en", "English"},
+				{"uk", "Українська"},
+				{"de", "Deutsch"},
+				{"fr", "Français"},
+				{"es", "Español"},
+			},
+			get: func(s *model.UserSettings) *string { return &s.SummaryLanguage },
+		},
+		{
+			key:   settingSummaryStyle,
+			title: "Стиль краткого содержания",
+			options: []settingOption{
+				{settingValueDefault, "Кратко"},
+				{summary.StyleDetailed, "Подробно"},
+				{summary.StyleBullets, "Тезисы списком"},
+			},
+			get: func(s *model.UserSettings) *string { return &s.SummaryStyle },
+		},
+		{
+			key:     settingPromptPreset,
+			title:   "Тип результата",
+			options: presetOptions,
+			get:     func(s *model.UserSettings) *string { return &s.PromptPreset },
+		},
+		{
+			key:   settingOutputFormat,
+			title: "Формат результата",
+			options: []settingOption{
+				{settingValueDefault, "Сообщение"},
+				{model.OutputFormatFile, "Файл"},
+			},
+			get: func(s *model.UserSettings) *string { return &s.OutputFormat },
+		},
+		{
+			key:     settingChatModel,
+			title:   "Модель нейросети",
+			options: modelOptions,
+			get:     func(s *model.UserSettings) *string { return &s.ChatModel },
+		},
+	}
+}
+
+func (d settingDefinition) currentLabel(settings *model.UserSettings) string {
+	value := *d.get(settings)
+	if value == "" {
+		value = settingValueDefault
+	}
+	for _, option := range d.options {
+		if option.value == value {
+			return option.label
+		}
+	}
+	return value
+}
+
+// userSettings возвращает настройки пользователя; при ошибке хранилища - настройки по умолчанию
+func (a *app) userSettings(userID int64) model.UserSettings {
+	settings, err := a.repo.GetSettings(userID)
+	if err != nil {
+		log.Printf("Error loading settings for user %d: %v", userID, err)
+		return model.UserSettings{}
+	}
+	return settings
+}
+
+func (a *app) settingsOverview(settings *model.UserSettings) (string, tgbotapi.InlineKeyboardMarkup) {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, definition := range a.settingDefinitions() {
+		label := fmt.Sprintf("%s: %s", definition.title, definition.currentLabel(settings))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, callbackPrefixSettings+":"+definition.key),
+		))
+	}
+	return "⚙️ Настройки. Выберите параметр, который хотите изменить:", tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func (a *app) sendSettingsMenu(message *tgbotapi.Message) {
+	settings := a.userSettings(message.From.ID)
+	text, keyboard := a.settingsOverview(&settings)
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyMarkup = keyboard
+	if _, err := a.bot.Send(msg); err != nil {
+		log.Printf("Error sending settings menu to chat %d: %v", message.Chat.ID, err)
+	}
+}
+
+// handleSettingsCallback обрабатывает кнопки set:<key> (выбор параметра), set:<key>:<value> (сохранение)
+// и set:back (возврат к списку параметров)
+func (a *app) handleSettingsCallback(query *tgbotapi.CallbackQuery) {
+	if query.Message == nil {
+		answerCallback(a.bot, query, "")
+		return
+	}
+	chatID := query.Message.Chat.ID
+	messageID := query.Message.MessageID
+	parts := strings.SplitN(query.Data, ":", 3)
+
+	settings := a.userSettings(query.From.ID)
+	if len(parts) < 2 || parts[1] == "back" {
+		answerCallback(a.bot, query, "")
+		text, keyboard := a.settingsOverview(&settings)
+		a.editSettingsMessage(chatID, messageID, text, keyboard)
+		return
+	}
+
+	var definition *settingDefinition
+	for _, d := range a.settingDefinitions() {
+		if d.key == parts[1] {
+			definition = &d
+			break
+		}
+	}
+	if definition == nil {
+		answerCallback(a.bot, query, "Неизвестный параметр.")
+		return
+	}
+
+	if len(parts) == 2 {
+		answerCallback(a.bot, query, "")
+		var rows [][]tgbotapi.InlineKeyboardButton
+		current := definition.currentLabel(&settings)
+		for _, option := range definition.options {
+			label := option.label
+			if label == current {
+				label = "✅ " + label
+			}
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(label, callbackPrefixSettings+":"+definition.key+":"+option.value),
+			))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", callbackPrefixSettings+":back"),
+		))
+		a.editSettingsMessage(chatID, messageID, definition.title+":", tgbotapi.NewInlineKeyboardMarkup(rows...))
+		return
+	}
+
+	value := parts[2]
+	valid := false
+	for _, option := range definition.options {
+		if option.value == value {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		answerCallback(a.bot, query, "Недопустимое значение.")
+		return
+	}
+	if value == settingValueDefault {
+		value = ""
+	}
+	*definition.get(&settings) = value
+
+	if err := a.repo.SaveSettings(query.From.ID, settings); err != nil {
+		log.Printf("Error saving settings for user %d: %v", query.From.ID, err)
+		answerCallback(a.bot, query, "Не удалось сохранить настройки.")
+		return
+	}
+	answerCallback(a.bot, query, "Сохранено")
+	text, keyboard := a.settingsOverview(&settings)
+	a.editSettingsMessage(chatID, messageID, text, keyboard)
+}
+
+func (a *app) editSettingsMessage(chatID int64, messageID int, text string, keyboard tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, text, keyboard)
+	if _, err := a.bot.Send(edit); err != nil {
+		log.Printf("Error editing settings message in chat %d: %v", chatID, err)
+	}
+}
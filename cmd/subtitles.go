@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"main/internal/model"
+	"main/internal/storage"
+	"main/internal/stt"
+	"main/internal/subtitle"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const callbackPrefixSubtitles = "subs"
+
+// subtitlesKeyboard кнопки выгрузки транскрипта в .srt/.vtt для исходного сообщения sourceMessageID
+func subtitlesKeyboard(sourceMessageID int) tgbotapi.InlineKeyboardMarkup {
+	id := strconv.Itoa(sourceMessageID)
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📄 Субтитры .srt", callbackPrefixSubtitles+":"+subtitle.FormatSRT+":"+id),
+			tgbotapi.NewInlineKeyboardButtonData("📄 Субтитры .vtt", callbackPrefixSubtitles+":"+subtitle.FormatVTT+":"+id),
+		),
+	)
+}
+
+// saveTranscript сохраняет транскрипт исходного сообщения, чтобы позже отдать его субтитрами
+func (a *app) saveTranscript(chatID int64, messageID int, userID int64, source string, transcript *stt.Transcript) {
+	stored := &model.StoredTranscript{
+		UserID:    userID,
+		ChatID:    chatID,
+		MessageID: messageID,
+		Source:    source,
+		Language:  transcript.Language,
+		Duration:  transcript.Duration,
+		Text:      transcript.Text,
+		Segments:  transcript.Segments,
+	}
+	if err := a.repo.SaveTranscript(stored); err != nil {
+		log.Printf("Error saving transcript for message %d in chat %d: %v", messageID, chatID, err)
+	}
+}
+
+// offerSubtitles предлагает скачать сохраненный транскрипт субтитрами, если есть таймкоды
+func (a *app) offerSubtitles(chatID int64, sourceMessageID int, transcript *stt.Transcript) {
+	if len(transcript.Segments) == 0 {
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "Транскрипт с таймкодами можно скачать файлом субтитров:")
+	msg.ReplyToMessageID = sourceMessageID
+	msg.ReplyMarkup = subtitlesKeyboard(sourceMessageID)
+	if _, err := a.bot.Send(msg); err != nil {
+		log.Printf("Error sending subtitles offer to chat %d: %v", chatID, err)
+	}
+}
+
+// handleSubtitlesCallback обрабатывает нажатие кнопки subs:<format>:<messageID>
+func (a *app) handleSubtitlesCallback(query *tgbotapi.CallbackQuery) {
+	bot := a.bot
+	parts := strings.Split(query.Data, ":")
+	if len(parts) != 3 || query.Message == nil {
+		answerCallback(bot, query, "Некорректный запрос.")
+		return
+	}
+	format := parts[1]
+	sourceMessageID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		answerCallback(bot, query, "Некорректный запрос.")
+		return
+	}
+	chatID := query.Message.Chat.ID
+
+	transcript, err := a.repo.GetTranscript(chatID, sourceMessageID)
+	if errors.Is(err, storage.ErrNotFound) {
+		answerCallback(bot, query, "Транскрипт не найден, отправьте аудио или ссылку еще раз.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading transcript for chat %d: %v", chatID, err)
+		answerCallback(bot, query, "Не удалось загрузить транскрипт.")
+		return
+	}
+
+	content, err := subtitle.Format(format, transcript.Segments)
+	if err != nil {
+		log.Printf("Error formatting subtitles for chat %d: %v", chatID, err)
+		answerCallback(bot, query, "Неизвестный формат субтитров.")
+		return
+	}
+	answerCallback(bot, query, "")
+
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("transcript_%d.%s", sourceMessageID, format),
+		Bytes: []byte(content),
+	})
+	doc.ReplyToMessageID = sourceMessageID
+	if _, err := bot.Send(doc); err != nil {
+		log.Printf("Error sending subtitles document to chat %d: %v", chatID, err)
+	}
+}
+
+func answerCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, text string) {
+	if _, err := bot.Request(tgbotapi.NewCallback(query.ID, text)); err != nil {
+		log.Printf("Error answering callback query %s: %v", query.ID, err)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"main/internal/model"
+	"main/internal/source"
+	"main/internal/stt"
+	"main/internal/subtitle"
+	"main/internal/summary"
+	"strconv"
+	"strings"
+)
+
+// urlRequest ссылка из сообщения пользователя и фрагмент видео, который нужно обработать
+type urlRequest struct {
+	url       string
+	timeRange source.TimeRange
+}
+
+// parseURLRequest разбирает текст "<ссылка>" или "<ссылка> 10:00-25:30" (допустимо и "10:00 - 25:30").
+// Без явного диапазона начало берется из параметра t= ссылки. rangeErr заполняется, если ссылка подходит,
+// а диапазон нет.
+func (a *app) parseURLRequest(text string) (request urlRequest, ok bool, rangeErr error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return urlRequest{}, false, nil
+	}
+	_, u, ok := a.sources.Match(fields[0])
+	if !ok {
+		return urlRequest{}, false, nil
+	}
+	request = urlRequest{url: u.String(), timeRange: source.URLRange(u)}
+	if len(fields) > 1 {
+		timeRange, err := source.ParseRange(strings.Join(fields[1:], " "))
+		if err != nil {
+			return urlRequest{}, true, err
+		}
+		request.timeRange = timeRange
+	}
+	return request, true, nil
+}
+
+// rangeHint подсказка о синтаксисе фрагмента
+const rangeHint = "Не понял фрагмент видео. Укажите время после ссылки через пробел, например: <ссылка> 10:00-25:30 (или 10:00- до конца)."
+
+// formatRange показывает фрагмент как "10:00–25:30" или "10:00–конец"
+func formatRange(timeRange source.TimeRange) string {
+	end := "конец"
+	if timeRange.End > 0 {
+		end = summary.FormatTimestamp(timeRange.End)
+	}
+	return summary.FormatTimestamp(timeRange.Start) + "–" + end
+}
+
+// rangeCacheKey добавляет фрагмент к ключу кэша: результат по фрагменту не подходит для всего видео
+func rangeCacheKey(videoID string, timeRange source.TimeRange) string {
+	if timeRange.IsZero() {
+		return videoID
+	}
+	return fmt.Sprintf("%s@%s-%s", videoID,
+		strconv.FormatFloat(timeRange.Start, 'f', -1, 64), strconv.FormatFloat(timeRange.End, 'f', -1, 64))
+}
+
+// rangeDuration длительность фрагмента; для фрагмента до конца считается от длительности видео
+func rangeDuration(timeRange source.TimeRange, duration float64) float64 {
+	if timeRange.IsZero() {
+		return duration
+	}
+	end := timeRange.End
+	if end <= 0 || (duration > 0 && end > duration) {
+		end = duration
+	}
+	return max(end-timeRange.Start, 0)
+}
+
+// clipChapters оставляет главы, попадающие во фрагмент, и обрезает их по его границам
+func clipChapters(chapters []model.VideoChapter, timeRange source.TimeRange) []model.VideoChapter {
+	if timeRange.IsZero() {
+		return chapters
+	}
+	var clipped []model.VideoChapter
+	for _, chapter := range chapters {
+		if !timeRange.Contains(chapter.Start, chapter.End) {
+			continue
+		}
+		chapter.Start = max(chapter.Start, timeRange.Start)
+		if timeRange.End > 0 {
+			chapter.End = min(chapter.End, timeRange.End)
+		}
+		clipped = append(clipped, chapter)
+	}
+	return clipped
+}
+
+// filterTranscript оставляет фрагменты распознавания из диапазона (субтитры скачиваются для всего видео)
+func filterTranscript(transcript *stt.Transcript, timeRange source.TimeRange) *stt.Transcript {
+	if timeRange.IsZero() {
+		return transcript
+	}
+	var segments []model.TranscriptionSegment
+	for _, segment := range transcript.Segments {
+		if timeRange.Contains(segment.Start, segment.End) {
+			segments = append(segments, segment)
+		}
+	}
+	return &stt.Transcript{
+		Text:     subtitle.Text(segments),
+		Language: transcript.Language,
+		Duration: rangeDuration(timeRange, transcript.Duration),
+		Segments: segments,
+	}
+}
+
+// shiftTranscript сдвигает таймкоды распознанного фрагмента, чтобы они соответствовали времени в исходном видео
+func shiftTranscript(transcript *stt.Transcript, offset float64) {
+	if offset <= 0 {
+		return
+	}
+	for i := range transcript.Segments {
+		transcript.Segments[i].Start += offset
+		transcript.Segments[i].End += offset
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"main/internal/model"
+	"main/internal/usage"
+	"slices"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Сколько самых активных пользователей показывать в /stats
+const statsTopUsers = 5
+
+// recordTranscription учитывает распознанное аудио в квоте пользователя и в расходах
+func (a *app) recordTranscription(ctx context.Context, userID int64, seconds float64) {
+	a.recordUsage(userID, model.QuotaUsageAudioSeconds, seconds)
+	a.usage.RecordAudio(ctx, seconds)
+}
+
+func (a *app) prices() usage.Prices {
+	cfg := a.cfg()
+	return usage.Prices{
+		Prompt:     cfg.PricePromptTokens,
+		Completion: cfg.PriceCompletionTokens,
+		Audio:      cfg.PriceAudioMinute,
+	}
+}
+
+// handleUsageCommand показывает пользователю его расход за сегодня и за месяц
+func (a *app) handleUsageCommand(message *tgbotapi.Message) {
+	lines := []string{"Ваш расход:"}
+	for _, period := range usagePeriods(time.Now()) {
+		totals, err := a.repo.UsageTotals(message.From.ID, period.since)
+		if err != nil {
+			log.Printf("Error loading usage for user %d: %v", message.From.ID, err)
+			a.bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Не удалось получить расход, попробуйте позже."))
+			return
+		}
+		lines = append(lines, period.name+": "+a.formatUsage(totals))
+	}
+	a.bot.Send(tgbotapi.NewMessage(message.Chat.ID, strings.Join(lines, "\n")))
+}
+
+// handleStatsCommand показывает администратору задачи, очередь и расходы всех пользователей
+func (a *app) handleStatsCommand(message *tgbotapi.Message) {
+	if !a.requireAdmin(message) {
+		return
+	}
+	jobs, err := a.jobStats()
+	if err != nil {
+		log.Printf("Error loading job stats: %v", err)
+		jobs = "Не удалось получить статистику задач."
+	}
+	costs, err := a.usageStats()
+	if err != nil {
+		log.Printf("Error loading usage stats: %v", err)
+		costs = "Не удалось получить статистику расходов."
+	}
+	sendOrEditMessage(a.bot, message.Chat.ID, 0, jobs+"\n\n"+costs, message.MessageID)
+}
+
+func (a *app) usageStats() (string, error) {
+	prices := a.prices()
+	lines := []string{"Расходы всех пользователей"}
+	var monthTotals []model.UsageTotal
+	for _, period := range usagePeriods(time.Now()) {
+		totals, err := a.repo.UsageTotals(0, period.since)
+		if err != nil {
+			return "", err
+		}
+		monthTotals = totals
+		lines = append(lines, period.name+": "+a.formatUsage(totals))
+		for _, total := range mergeUsage(totals, func(t model.UsageTotal) string { return t.Kind + " " + t.Model }) {
+			lines = append(lines, "  "+total.Model+": "+a.formatUsage([]model.UsageTotal{total}))
+		}
+	}
+
+	// usagePeriods заканчивается месяцем - по нему и считаем самых активных
+	byUser := mergeUsage(monthTotals, func(t model.UsageTotal) string { return fmt.Sprint(t.UserID) })
+	costs := make(map[int64]float64, len(byUser))
+	for _, total := range monthTotals {
+		costs[total.UserID] += prices.Cost(total)
+	}
+	slices.SortFunc(byUser, func(x, y model.UsageTotal) int { return cmp.Compare(costs[y.UserID], costs[x.UserID]) })
+	if len(byUser) > 0 {
+		lines = append(lines, "Больше всего за месяц:")
+	}
+	for _, total := range byUser[:min(statsTopUsers, len(byUser))] {
+		lines = append(lines, fmt.Sprintf("  %s: ≈ %.2f %s", a.userLabel(total.UserID), costs[total.UserID], a.cfg().PriceCurrency))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// formatUsage описание расхода: запросы к нейросети, токены, минуты аудио и оценка стоимости
+func (a *app) formatUsage(totals []model.UsageTotal) string {
+	prices := a.prices()
+	var requests, promptTokens, completionTokens int
+	var audioSeconds, cost float64
+	for _, total := range totals {
+		if total.Kind == model.UsageKindLLM {
+			requests += total.Requests
+			promptTokens += total.PromptTokens
+			completionTokens += total.CompletionTokens
+		}
+		audioSeconds += total.AudioSeconds
+		cost += prices.Cost(total)
+	}
+	if requests == 0 && audioSeconds == 0 {
+		return "нет запросов"
+	}
+
+	var parts []string
+	if requests > 0 {
+		parts = append(parts, fmt.Sprintf("нейросеть - %d запросов, %d токенов (вход %d, ответ %d)",
+			requests, promptTokens+completionTokens, promptTokens, completionTokens))
+	}
+	if audioSeconds > 0 {
+		parts = append(parts, "аудио - "+formatMinutes(audioSeconds))
+	}
+	return strings.Join(parts, "; ") + fmt.Sprintf("; ≈ %.2f %s", cost, a.cfg().PriceCurrency)
+}
+
+// userLabel ID пользователя и его имя в Telegram, если бот его знает
+func (a *app) userLabel(userID int64) string {
+	user, err := a.repo.GetUser(userID)
+	if err != nil || user.UserName == "" {
+		return fmt.Sprint(userID)
+	}
+	return fmt.Sprintf("%d (@%s)", userID, user.UserName)
+}
+
+type usagePeriod struct {
+	name  string
+	since time.Time
+}
+
+// usagePeriods календарные периоды отчетов о расходе по локальному времени сервера
+func usagePeriods(now time.Time) []usagePeriod {
+	y, m, d := now.Date()
+	return []usagePeriod{
+		{name: "Сегодня", since: time.Date(y, m, d, 0, 0, 0, 0, now.Location())},
+		{name: "С начала месяца", since: time.Date(y, m, 1, 0, 0, 0, 0, now.Location())},
+	}
+}
+
+// mergeUsage складывает расход с одинаковым ключом, сохраняя порядок первого появления.
+// В результате у слитых записей остаются поля первой записи (UserID, Kind, Model).
+func mergeUsage(totals []model.UsageTotal, key func(model.UsageTotal) string) []model.UsageTotal {
+	var merged []model.UsageTotal
+	index := make(map[string]int)
+	for _, total := range totals {
+		i, ok := index[key(total)]
+		if !ok {
+			index[key(total)] = len(merged)
+			merged = append(merged, total)
+			continue
+		}
+		merged[i].Requests += total.Requests
+		merged[i].PromptTokens += total.PromptTokens
+		merged[i].CompletionTokens += total.CompletionTokens
+		merged[i].AudioSeconds += total.AudioSeconds
+	}
+	return merged
+}
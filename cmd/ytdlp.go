@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"main/internal/config"
+	"main/internal/metrics"
+	"main/internal/model"
+	"main/internal/source"
+	"main/internal/stt"
+	"main/internal/subtitle"
+	"main/internal/summary"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	subtitleSourceManual = "manual"
+	subtitleSourceAuto   = "auto"
+)
+
+// videoSubtitles субтитры видео, полученные вместо распознавания речи
+type videoSubtitles struct {
+	transcript *stt.Transcript
+	kind       string // subtitleSourceManual или subtitleSourceAuto
+	language   string
+	source     string // название площадки
+}
+
+// describe описание источника текста для сообщений пользователю
+func (s *videoSubtitles) describe() string {
+	if s.kind == subtitleSourceManual {
+		return fmt.Sprintf("субтитров %s, язык %s", s.source, s.language)
+	}
+	return fmt.Sprintf("автоматических субтитров %s, язык %s", s.source, s.language)
+}
+
+// ytdlpMetadata поля JSON из yt-dlp --dump-json, которые нужны боту
+type ytdlpMetadata struct {
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	Channel     string  `json:"channel"`
+	Uploader    string  `json:"uploader"`
+	Duration    float64 `json:"duration"`
+	UploadDate  string  `json:"upload_date"` // YYYYMMDD
+	Description string  `json:"description"`
+	Chapters    []struct {
+		Title     string  `json:"title"`
+		StartTime float64 `json:"start_time"`
+		EndTime   float64 `json:"end_time"`
+	} `json:"chapters"`
+}
+
+// fetchVideoMetadata получает название, канал, длительность, дату публикации, описание и главы видео
+func fetchVideoMetadata(ctx context.Context, videoURL string, src *source.Source, cfg *config.Config) (*model.VideoMetadata, error) {
+	args := []string{"--dump-json", "--skip-download", "--no-playlist", "--no-warnings"}
+	args = append(args, ytdlpArgs(cfg, src)...)
+	args = append(args, videoURL)
+
+	cmd := exec.CommandContext(ctx, "yt-dlp", args...)
+	cmd.WaitDelay = 10 * time.Second
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("yt-dlp --dump-json failed: %w. Output: %s", err, stderr.String())
+	}
+
+	var raw ytdlpMetadata
+	if err := json.Unmarshal(stdout.Bytes(), &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse yt-dlp metadata: %w", err)
+	}
+	metadata := &model.VideoMetadata{
+		ID:          raw.ID,
+		Title:       raw.Title,
+		Channel:     raw.Channel,
+		Duration:    raw.Duration,
+		Description: raw.Description,
+	}
+	if metadata.Channel == "" {
+		metadata.Channel = raw.Uploader
+	}
+	if date, err := time.Parse("20060102", raw.UploadDate); err == nil {
+		metadata.UploadDate = date
+	}
+	for _, chapter := range raw.Chapters {
+		metadata.Chapters = append(metadata.Chapters, model.VideoChapter{
+			Title: chapter.Title,
+			Start: chapter.StartTime,
+			End:   chapter.EndTime,
+		})
+	}
+	return metadata, nil
+}
+
+// ytdlpPlaylist поля JSON из yt-dlp --flat-playlist --dump-single-json
+type ytdlpPlaylist struct {
+	Title   string `json:"title"`
+	Entries []struct {
+		URL        string `json:"url"`
+		WebpageURL string `json:"webpage_url"`
+		Title      string `json:"title"`
+	} `json:"entries"`
+}
+
+// fetchPlaylist получает название плейлиста и ссылки на первые maxEntries видео, не скачивая их
+func fetchPlaylist(ctx context.Context, playlistURL string, src *source.Source, cfg *config.Config, maxEntries int) (string, []model.BatchEntry, error) {
+	args := []string{"--flat-playlist", "--dump-single-json", "--playlist-end", strconv.Itoa(maxEntries), "--no-warnings"}
+	args = append(args, ytdlpArgs(cfg, src)...)
+	args = append(args, playlistURL)
+
+	cmd := exec.CommandContext(ctx, "yt-dlp", args...)
+	cmd.WaitDelay = 10 * time.Second
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", nil, fmt.Errorf("yt-dlp --flat-playlist failed: %w. Output: %s", err, stderr.String())
+	}
+
+	var raw ytdlpPlaylist
+	if err := json.Unmarshal(stdout.Bytes(), &raw); err != nil {
+		return "", nil, fmt.Errorf("failed to parse yt-dlp playlist: %w", err)
+	}
+	entries := make([]model.BatchEntry, 0, len(raw.Entries))
+	for _, entry := range raw.Entries {
+		entryURL := entry.URL
+		if entryURL == "" {
+			entryURL = entry.WebpageURL
+		}
+		if entryURL != "" {
+			entries = append(entries, model.BatchEntry{URL: entryURL, Title: entry.Title})
+		}
+	}
+	return raw.Title, entries, nil
+}
+
+// videoHeader заголовок ответа со сведениями о видео и обработанном фрагменте
+func videoHeader(metadata *model.VideoMetadata, timeRange source.TimeRange) string {
+	if metadata == nil {
+		return ""
+	}
+	var lines []string
+	if metadata.Title != "" {
+		lines = append(lines, "🎬 "+metadata.Title)
+	}
+	var details []string
+	if metadata.Channel != "" {
+		details = append(details, "📺 "+metadata.Channel)
+	}
+	if !metadata.UploadDate.IsZero() {
+		details = append(details, "📅 "+metadata.UploadDate.Format("02.01.2006"))
+	}
+	if metadata.Duration > 0 {
+		details = append(details, "⏱ "+summary.FormatTimestamp(metadata.Duration))
+	}
+	if len(details) > 0 {
+		lines = append(lines, strings.Join(details, " · "))
+	}
+	if len(metadata.Chapters) > 0 {
+		lines = append(lines, fmt.Sprintf("📑 Глав: %d", len(metadata.Chapters)))
+	}
+	if !timeRange.IsZero() {
+		lines = append(lines, "✂️ Фрагмент "+formatRange(timeRange))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n\n"
+}
+
+// ytdlpArgs дополнительные аргументы yt-dlp для площадки и cookies, если площадка их использует
+func ytdlpArgs(cfg *config.Config, src *source.Source) []string {
+	args := append([]string(nil), src.YtdlpArgs...)
+	if src.Cookies {
+		args = append(args, youtubeCookiesArgs(cfg)...)
+	}
+	return args
+}
+
+// youtubeCookiesArgs аргументы yt-dlp для cookies, если файл указан в конфиге и существует
+func youtubeCookiesArgs(cfg *config.Config) []string {
+	if cfg.YoutubeCookiesPath == "" {
+		log.Println("WARNING: YouTube cookies file not specified in config. Downloads may fail due to bot detection.")
+		return nil
+	}
+	// Проверяем, существует ли файл cookies
+	if _, err := os.Stat(cfg.YoutubeCookiesPath); err != nil {
+		log.Printf("WARNING: YouTube cookies file specified but not found at %s: %v. Proceeding without cookies.", cfg.YoutubeCookiesPath, err)
+		return nil
+	}
+	log.Printf("Using YouTube cookies from: %s", cfg.YoutubeCookiesPath)
+	return []string{"--cookies", cfg.YoutubeCookiesPath}
+}
+
+// subtitleLanguages предпочтительные языки субтитров: язык распознавания из настроек пользователя,
+// затем YOUTUBE_SUBTITLE_LANGUAGES
+func subtitleLanguages(cfg *config.Config, preferred string) []string {
+	var languages []string
+	if preferred != "" {
+		languages = append(languages, preferred)
+	}
+	for _, language := range cfg.YoutubeSubtitleLanguages {
+		language = strings.TrimSpace(language)
+		if language != "" && language != preferred {
+			languages = append(languages, language)
+		}
+	}
+	return languages
+}
+
+// downloadSubtitles ищет субтитры видео: сначала загруженные автором на одном из языков
+// languages, затем автоматические (предпочтительно оригинальную дорожку "<lang>-orig", а не машинный перевод).
+// Если субтитров нет, возвращает nil без ошибки.
+func downloadSubtitles(ctx context.Context, videoURL string, src *source.Source, cfg *config.Config, languages []string) (*videoSubtitles, error) {
+	if len(languages) == 0 {
+		return nil, nil
+	}
+	dir, err := os.MkdirTemp(uploadDir, youtubeAudioPrefix+"subs_*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir for subtitles: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("Error removing temp subtitles dir %s: %v", dir, err)
+		}
+	}()
+
+	stages := []struct {
+		kind  string
+		flag  string
+		langs []string
+	}{
+		{subtitleSourceManual, "--write-subs", languages},
+		{subtitleSourceAuto, "--write-auto-subs", append([]string{".*-orig"}, languages...)},
+	}
+	for _, stage := range stages {
+		args := []string{
+			"--skip-download",
+			stage.flag,
+			"--sub-langs", strings.Join(stage.langs, ","),
+			"--sub-format", "vtt",
+			"-o", filepath.Join(dir, stage.kind),
+			"--no-playlist",
+			"--quiet",
+			"--no-warnings",
+		}
+		args = append(args, ytdlpArgs(cfg, src)...)
+		args = append(args, videoURL)
+
+		cmd := exec.CommandContext(ctx, "yt-dlp", args...)
+		cmd.WaitDelay = 10 * time.Second
+		var output bytes.Buffer
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+		if err := cmd.Run(); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			// Ошибка получения субтитров не фатальна: дальше попробуем распознать аудио
+			log.Printf("yt-dlp subtitles error for URL %s: %v\nOutput: %s", videoURL, err, output.String())
+			return nil, nil
+		}
+
+		path, language := pickSubtitleFile(dir, stage.kind, languages)
+		if path == "" {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read subtitles %s: %w", path, err)
+		}
+		segments, err := subtitle.ParseVTT(string(content))
+		if err != nil {
+			log.Printf("Error parsing subtitles %s for URL %s: %v", path, videoURL, err)
+			continue
+		}
+		text := subtitle.Text(segments)
+		if text == "" {
+			continue
+		}
+
+		log.Printf("Using %s subtitles (%s) for URL %s: %d segments", stage.kind, language, videoURL, len(segments))
+		return &videoSubtitles{
+			transcript: &stt.Transcript{
+				Text:     text,
+				Language: language,
+				Duration: segments[len(segments)-1].End,
+				Segments: segments,
+			},
+			kind:     stage.kind,
+			language: language,
+			source:   src.Title,
+		}, nil
+	}
+	return nil, nil
+}
+
+// pickSubtitleFile выбирает из скачанных файлов <prefix>.<lang>.vtt оригинальную дорожку,
+// а если ее нет - первый язык по порядку предпочтения. Выбор детерминирован: от него зависит
+// закэшированный транскрипт видео.
+func pickSubtitleFile(dir, prefix string, languages []string) (string, string) {
+	files, err := filepath.Glob(filepath.Join(dir, prefix+".*.vtt"))
+	if err != nil || len(files) == 0 {
+		return "", ""
+	}
+	byLanguage := make(map[string]string, len(files))
+	for _, file := range files {
+		language := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), prefix+"."), ".vtt")
+		byLanguage[language] = file
+	}
+	// Сначала предпочитаемые языки по порядку, затем остальные по алфавиту
+	candidates := slices.Clone(languages)
+	for _, language := range slices.Sorted(maps.Keys(byLanguage)) {
+		language = strings.TrimSuffix(language, "-orig")
+		if !slices.Contains(candidates, language) {
+			candidates = append(candidates, language)
+		}
+	}
+	for _, language := range candidates {
+		if file, ok := byLanguage[language+"-orig"]; ok {
+			return file, language
+		}
+	}
+	for _, language := range candidates {
+		if file, ok := byLanguage[language]; ok {
+			return file, language
+		}
+	}
+	return "", ""
+}
+
+// downloadAudioWithYtdlp скачивает звуковую дорожку видео в mp3; если задан диапазон, скачивается только он
+func downloadAudioWithYtdlp(ctx context.Context, videoURL string, src *source.Source, cfg *config.Config, timeRange source.TimeRange) (string, error) {
+	tempFile, err := os.CreateTemp(uploadDir, youtubeAudioPattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file for youtube audio name: %w", err)
+	}
+	mp3FilePath := tempFile.Name()
+	if err := tempFile.Close(); err != nil {
+		log.Printf("Warning: failed to close temp file handle for %s: %v", mp3FilePath, err)
+	}
+	os.Remove(mp3FilePath)
+
+	log.Printf("Downloading audio from URL: %s to %s", videoURL, mp3FilePath)
+
+	args := []string{
+		"-o", mp3FilePath, // путь для сохранения
+		"-x", // извлечь аудио
+		"--audio-format", "mp3",
+		"--no-playlist", // не скачивать плейлист
+		"--quiet",       // меньше вывода
+		"--no-warnings", // нет предупреждений
+	}
+
+	if !timeRange.IsZero() {
+		end := "inf"
+		if timeRange.End > 0 {
+			end = strconv.FormatFloat(timeRange.End, 'f', -1, 64)
+		}
+		args = append(args,
+			"--download-sections", "*"+strconv.FormatFloat(timeRange.Start, 'f', -1, 64)+"-"+end,
+			"--force-keyframes-at-cuts", // точные границы фрагмента, а не по ближайшему ключевому кадру
+		)
+	}
+	args = append(args, ytdlpArgs(cfg, src)...)
+	args = append(args, videoURL) // URL всегда последний
+
+	cmd := exec.CommandContext(ctx, "yt-dlp", args...)
+	// yt-dlp запускает ffmpeg дочерним процессом: после отмены не ждем вечно, пока он закроет вывод
+	cmd.WaitDelay = 10 * time.Second
+
+	var stdOutAndErr bytes.Buffer
+	cmd.Stdout = &stdOutAndErr
+	cmd.Stderr = &stdOutAndErr
+
+	start := time.Now()
+	err = cmd.Run()
+	metrics.ObserveSince(metrics.DownloadDuration.WithLabelValues("ytdlp", metrics.Result(err)), start)
+	if err != nil {
+		log.Printf("yt-dlp error for URL %s: %v\nOutput: %s", videoURL, err, stdOutAndErr.String())
+		if _, statErr := os.Stat(mp3FilePath); statErr == nil {
+			os.Remove(mp3FilePath)
+		}
+		return "", fmt.Errorf("yt-dlp failed: %w. Output: %s", err, stdOutAndErr.String())
+	}
+
+	fileInfo, err := os.Stat(mp3FilePath)
+	if os.IsNotExist(err) {
+		log.Printf("yt-dlp ran but output file %s not found. Output: %s", mp3FilePath, stdOutAndErr.String())
+		return "", fmt.Errorf("yt-dlp output file not found: %s. Output: %s", mp3FilePath, stdOutAndErr.String())
+	}
+	if err != nil {
+		log.Printf("Error stating output file %s: %v. Output: %s", mp3FilePath, err, stdOutAndErr.String())
+		return "", fmt.Errorf("error stating yt-dlp output file %s: %w. Output: %s", mp3FilePath, err, stdOutAndErr.String())
+	}
+	if fileInfo.Size() == 0 {
+		log.Printf("yt-dlp created an empty file %s. Output: %s", mp3FilePath, stdOutAndErr.String())
+		os.Remove(mp3FilePath)
+		return "", fmt.Errorf("yt-dlp created an empty file: %s. Output: %s", mp3FilePath, stdOutAndErr.String())
+	}
+
+	log.Printf("Successfully downloaded audio to %s (size: %d bytes)", mp3FilePath, fileInfo.Size())
+	return mp3FilePath, nil
+}
@@ -0,0 +1,97 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"main/internal/metrics"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConvertToWav конвертирует аудио (или звуковую дорожку видео) в 16 кГц моно WAV (формат, который понимают все распознаватели)
+func ConvertToWav(ctx context.Context, inputPath string, wavPath string) error {
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-i", inputPath, "-y", "-vn", "-acodec", "pcm_s16le", "-ar", "16000", "-ac", "1", wavPath)
+	start := time.Now()
+	output, err := cmd.CombinedOutput()
+	observe("convert_wav", start, err)
+	if err != nil {
+		log.Printf("ffmpeg error for %s -> %s: %v\nOutput: %s", inputPath, wavPath, err, string(output))
+		return fmt.Errorf("ffmpeg conversion failed: %w. Output: %s", err, string(output))
+	}
+	log.Printf("Converted %s to %s", inputPath, wavPath)
+	return nil
+}
+
+// ConvertToMP3 извлекает звуковую дорожку в моно mp3 16 кГц (так файл меньше и быстрее отправляется распознавателю)
+func ConvertToMP3(ctx context.Context, inputPath string, mp3Path string) error {
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-i", inputPath, "-y", "-vn", "-ac", "1", "-ar", "16000", "-b:a", "64k", mp3Path)
+	start := time.Now()
+	output, err := cmd.CombinedOutput()
+	observe("convert_mp3", start, err)
+	if err != nil {
+		log.Printf("ffmpeg error for %s -> %s: %v\nOutput: %s", inputPath, mp3Path, err, string(output))
+		return fmt.Errorf("ffmpeg conversion failed: %w. Output: %s", err, string(output))
+	}
+	log.Printf("Converted %s to %s", inputPath, mp3Path)
+	return nil
+}
+
+// Duration возвращает длительность аудиофайла в секундах (через ffprobe)
+func Duration(ctx context.Context, path string) (float64, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", path)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	start := time.Now()
+	err := cmd.Run()
+	observe("duration", start, err)
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed for %s: %w. Output: %s", path, err, stderr.String())
+	}
+	duration, err := strconv.ParseFloat(strings.TrimSpace(stdout.String()), 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse ffprobe duration %q: %w", stdout.String(), err)
+	}
+	return duration, nil
+}
+
+// Extract вырезает фрагмент [start, start+length) в моно mp3 с фиксированным битрейтом,
+// чтобы размер фрагмента был предсказуемым
+func Extract(ctx context.Context, inputPath string, outputPath string, start, length float64) error {
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-ss", formatSeconds(start),
+		"-t", formatSeconds(length),
+		"-i", inputPath,
+		"-y", "-vn", "-ac", "1", "-ar", "16000", "-b:a", "64k",
+		outputPath)
+	started := time.Now()
+	output, err := cmd.CombinedOutput()
+	observe("extract", started, err)
+	if err != nil {
+		log.Printf("ffmpeg extract error for %s [%.1f, +%.1f]: %v\nOutput: %s", inputPath, start, length, err, string(output))
+		return fmt.Errorf("ffmpeg extract failed: %w. Output: %s", err, string(output))
+	}
+	return nil
+}
+
+// observe учитывает время выполнения ffmpeg или ffprobe в метриках
+func observe(operation string, start time.Time, err error) {
+	metrics.ObserveSince(metrics.FFmpegDuration.WithLabelValues(operation, metrics.Result(err)), start)
+}
+
+// RemoveFile удаляет временный файл, игнорируя отсутствие файла
+func RemoveFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing temp file %s: %v", path, err)
+	}
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
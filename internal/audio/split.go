@@ -0,0 +1,133 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Длительность тишины и порог громкости для поиска пауз, на которых удобно резать аудио
+const (
+	silenceNoise    = "-30dB"
+	silenceDuration = "0.5"
+)
+
+var (
+	silenceStartRegex = regexp.MustCompile(`silence_start: (-?[\d.]+)`)
+	silenceEndRegex   = regexp.MustCompile(`silence_end: (-?[\d.]+)`)
+)
+
+// Segment фрагмент исходного аудио, сохраненный в отдельный файл
+type Segment struct {
+	Index int
+	Path  string
+	Start float64
+	End   float64
+}
+
+// SplitOptions параметры нарезки аудио
+type SplitOptions struct {
+	ChunkSeconds   float64 // целевая длина фрагмента
+	OverlapSeconds float64 // перекрытие соседних фрагментов
+	SearchSeconds  float64 // окно перед границей фрагмента, в котором ищется пауза
+}
+
+// Split режет аудио на перекрывающиеся фрагменты в каталоге dir.
+// Границы по возможности выбираются по паузам (ffmpeg silencedetect).
+func Split(ctx context.Context, inputPath string, dir string, opts SplitOptions) ([]Segment, error) {
+	if opts.ChunkSeconds <= 0 {
+		return nil, fmt.Errorf("chunk length must be positive, got %.1f", opts.ChunkSeconds)
+	}
+
+	duration, err := Duration(ctx, inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	silences, err := detectSilences(ctx, inputPath)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		// Без пауз режем по фиксированным границам
+		silences = nil
+	}
+
+	cuts := cutPoints(duration, silences, opts)
+
+	segments := make([]Segment, 0, len(cuts))
+	prevCut := 0.0
+	for i, cut := range cuts {
+		start := math.Max(0, prevCut-opts.OverlapSeconds)
+		segment := Segment{
+			Index: i,
+			Path:  filepath.Join(dir, fmt.Sprintf("chunk_%03d.mp3", i)),
+			Start: start,
+			End:   cut,
+		}
+		if err := Extract(ctx, inputPath, segment.Path, segment.Start, segment.End-segment.Start); err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment)
+		prevCut = cut
+	}
+	return segments, nil
+}
+
+// cutPoints возвращает концы фрагментов; последний всегда равен duration
+func cutPoints(duration float64, silences []float64, opts SplitOptions) []float64 {
+	var cuts []float64
+	prev := 0.0
+	for duration-prev > opts.ChunkSeconds {
+		target := prev + opts.ChunkSeconds
+		cut := target
+		// Ищем паузу, ближайшую к целевой границе слева, чтобы не превысить длину фрагмента
+		for _, s := range silences {
+			if s > target {
+				break
+			}
+			if s > prev && target-s <= opts.SearchSeconds {
+				cut = s
+			}
+		}
+		cuts = append(cuts, cut)
+		prev = cut
+	}
+	return append(cuts, duration)
+}
+
+// detectSilences возвращает середины найденных пауз в секундах, по возрастанию
+func detectSilences(ctx context.Context, inputPath string) ([]float64, error) {
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-i", inputPath, "-af",
+		fmt.Sprintf("silencedetect=noise=%s:d=%s", silenceNoise, silenceDuration), "-f", "null", "-")
+	started := time.Now()
+	output, err := cmd.CombinedOutput()
+	observe("silence", started, err)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg silencedetect failed: %w", err)
+	}
+
+	var silences []float64
+	start := -1.0
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := silenceStartRegex.FindStringSubmatch(line); m != nil {
+			start, _ = strconv.ParseFloat(m[1], 64)
+			continue
+		}
+		if m := silenceEndRegex.FindStringSubmatch(line); m != nil && start >= 0 {
+			end, _ := strconv.ParseFloat(m[1], 64)
+			silences = append(silences, (math.Max(0, start)+end)/2)
+			start = -1
+		}
+	}
+	return silences, nil
+}
@@ -0,0 +1,33 @@
+package audio
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCutPoints(t *testing.T) {
+	opts := SplitOptions{ChunkSeconds: 600, OverlapSeconds: 5, SearchSeconds: 30}
+	tests := []struct {
+		name     string
+		duration float64
+		silences []float64
+		want     []float64
+	}{
+		{"shorter than chunk", 300, nil, []float64{300}},
+		{"exactly one chunk", 600, nil, []float64{600}},
+		{"fixed cuts without silences", 1500, nil, []float64{600, 1200, 1500}},
+		{"cut at silence before target", 1000, []float64{590}, []float64{590, 1000}},
+		{"closest silence to target wins", 1000, []float64{575, 590, 598}, []float64{598, 1000}},
+		{"silence outside search window ignored", 1000, []float64{500}, []float64{600, 1000}},
+		{"silence after target ignored", 1000, []float64{610}, []float64{600, 1000}},
+		{"next chunk counts from previous cut", 1300, []float64{580, 1170}, []float64{580, 1170, 1300}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cutPoints(tt.duration, tt.silences, opts)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("cutPoints(%v, %v) = %v, want %v", tt.duration, tt.silences, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,106 @@
 package config
 
+import (
+	coreconfig "main/tools/pkg/core_config"
+	"time"
+)
+
 type Config struct {
+	coreconfig.App      // APP_ADDR: адрес HTTP-сервера для вебхука
+	coreconfig.Database // DB_URI, DB_HOST, ...: Postgres или встроенный SQLite (по умолчанию ./upload/bot.db)
+
 	TelegramBotToken   string `envconfig:"TELEGRAM_BOT_TOKEN" default:"1s"`
 	BothubApiToken     string `envconfig:"BOTHUB_API_TOKEN" default:"1sds33s"`
 	YoutubeCookiesPath string `envconfig:"YOUTUBE_COOKIES_PATH" default:"./upload/cookies.txt"`
+
+	// Доступ к боту: при ACCESS_CONTROL=true ботом пользуются только администраторы (ADMIN_IDS - Telegram ID
+	// через запятую), пользователи, активировавшие код приглашения (/invite), и разрешенные группы (/allowchat).
+	// По умолчанию выключено, чтобы обновление не закрыло бот для всех: включается вместе с ADMIN_IDS
+	AccessControl bool          `envconfig:"ACCESS_CONTROL" default:"false"`
+	AdminIDs      []int64       `envconfig:"ADMIN_IDS"`
+	InviteTTL     time.Duration `envconfig:"INVITE_TTL" default:"168h"`
+
+	// Пауза между сообщениями рассылки /broadcast (лимит Telegram - около 30 сообщений в секунду)
+	BroadcastInterval time.Duration `envconfig:"BROADCAST_INTERVAL" default:"100ms"`
+
+	// Квоты пользователя (0 - без ограничения, администраторы не ограничены): минуты распознанного аудио
+	// за сутки, ссылки на обработку за час и максимальная длительность одного файла или видео.
+	// Администратор назначает отдельному пользователю свои лимиты командой /quota
+	QuotaAudioMinutesPerDay int `envconfig:"QUOTA_AUDIO_MINUTES_PER_DAY" default:"0"`
+	QuotaSummariesPerHour   int `envconfig:"QUOTA_SUMMARIES_PER_HOUR" default:"0"`
+	QuotaMaxDurationMinutes int `envconfig:"QUOTA_MAX_DURATION_MINUTES" default:"0"`
+
+	// Субтитры YouTube вместо распознавания речи: сначала загруженные автором, затем автоматические.
+	// Язык распознавания из настроек пользователя проверяется первым.
+	YoutubeSubtitles         bool     `envconfig:"YOUTUBE_SUBTITLES" default:"true"`
+	YoutubeSubtitleLanguages []string `envconfig:"YOUTUBE_SUBTITLE_LANGUAGES" default:"ru,en"`
+
+	// Хосты, ссылки с которых принимает бот (с поддоменами; "*" - любые). Прямые ссылки на аудио/видеофайлы
+	// скачиваются по HTTP с любого хоста из списка, но не больше DIRECT_MAX_BYTES
+	AllowedHosts   []string `envconfig:"ALLOWED_HOSTS" default:"youtube.com,youtu.be,vk.com,vk.ru,vkvideo.ru,rutube.ru,vimeo.com,podcasts.apple.com,soundcloud.com"`
+	DirectMaxBytes int64    `envconfig:"DIRECT_MAX_BYTES" default:"524288000"`
+
+	// Сколько хранить транскрипты и результаты по ссылкам для повторных запросов того же видео (0 - без кэша)
+	CacheTTL time.Duration `envconfig:"CACHE_TTL" default:"168h"`
+
+	// Ссылки на плейлисты и каналы: сколько первых видео обрабатывать (0 - плейлисты не обрабатываются)
+	PlaylistMaxVideos int `envconfig:"PLAYLIST_MAX_VIDEOS" default:"20"`
+
+	// Распознавание речи: bothub, openai (любой OpenAI-совместимый API) или local (whisper.cpp, faster-whisper)
+	SttProvider     string   `envconfig:"STT_PROVIDER" default:"bothub"`
+	SttApiURL       string   `envconfig:"STT_API_URL"`   // переопределяет URL эндпоинта /audio/transcriptions
+	SttApiToken     string   `envconfig:"STT_API_TOKEN"` // для bothub по умолчанию используется BOTHUB_API_TOKEN
+	SttModel        string   `envconfig:"STT_MODEL" default:"whisper-1"`
+	SttLanguage     string   `envconfig:"STT_LANGUAGE"`
+	SttLocalCommand string   `envconfig:"STT_LOCAL_COMMAND"` // путь к бинарнику, например whisper-cli
+	SttLocalArgs    []string `envconfig:"STT_LOCAL_ARGS"`    // аргументы через запятую, поддерживают {input}, {model}, {language}
+	SttLocalModel   string   `envconfig:"STT_LOCAL_MODEL"`   // путь к файлу модели для локального распознавателя
+
+	// Нарезка аудио для HTTP-провайдеров: файлы больше STT_MAX_UPLOAD_BYTES (лимит Whisper API - 25 МБ на файл)
+	// или длиннее STT_CHUNK_SECONDS распознаются фрагментами
+	SttMaxUploadBytes      int64   `envconfig:"STT_MAX_UPLOAD_BYTES" default:"24000000"`
+	SttChunkSeconds        float64 `envconfig:"STT_CHUNK_SECONDS" default:"600"`
+	SttChunkOverlapSeconds float64 `envconfig:"STT_CHUNK_OVERLAP_SECONDS" default:"5"`
+	SttChunkSearchSeconds  float64 `envconfig:"STT_CHUNK_SEARCH_SECONDS" default:"30"`
+	SttChunkWorkers        int     `envconfig:"STT_CHUNK_WORKERS" default:"3"`
+
+	// Суммаризация: транскрипты длиннее SUMMARY_MAX_INPUT_TOKENS делятся на разделы (map-reduce)
+	SummaryMaxInputTokens int `envconfig:"SUMMARY_MAX_INPUT_TOKENS" default:"12000"`
+	SummaryWorkers        int `envconfig:"SUMMARY_WORKERS" default:"3"`
+
+	// Шаблоны запросов: встроенные пресеты (summary, key_points, meeting_minutes, study_notes)
+	// и файлы <name>.tmpl из PROMPTS_DIR; PROMPT_PRESET - пресет по умолчанию
+	PromptsDir   string `envconfig:"PROMPTS_DIR" default:"./upload/prompts"`
+	PromptPreset string `envconfig:"PROMPT_PRESET" default:"summary"`
+
+	// Вопросы по транскрипту (ответ на сообщение с результатом): сколько токенов истории диалога хранить
+	QAHistoryTokens int `envconfig:"QA_HISTORY_TOKENS" default:"3000"`
+
+	// Модель нейросети по умолчанию и список моделей, доступных пользователям в настройках
+	ChatModel  string   `envconfig:"CHAT_MODEL" default:"gpt-4o"`
+	ChatModels []string `envconfig:"CHAT_MODELS" default:"gpt-4o,gpt-4o-mini"`
+
+	// Цены для оценки расходов в /usage и /stats (модель:цена через запятую): за 1 млн входных токенов,
+	// за 1 млн токенов ответа и за минуту распознанного аудио (по STT_MODEL)
+	PricePromptTokens     map[string]float64 `envconfig:"PRICE_PROMPT_TOKENS" default:"gpt-4o:2.5,gpt-4o-mini:0.15"`
+	PriceCompletionTokens map[string]float64 `envconfig:"PRICE_COMPLETION_TOKENS" default:"gpt-4o:10,gpt-4o-mini:0.6"`
+	PriceAudioMinute      map[string]float64 `envconfig:"PRICE_AUDIO_MINUTE" default:"whisper-1:0.006"`
+	PriceCurrency         string             `envconfig:"PRICE_CURRENCY" default:"$"`
+
+	// Получение обновлений: polling (long polling) или webhook (HTTP-сервер на APP_ADDR)
+	UpdatesMode   string `envconfig:"UPDATES_MODE" default:"polling"`
+	WebhookURL    string `envconfig:"WEBHOOK_URL"` // публичный URL, например https://bot.example.com/telegram/webhook
+	WebhookPath   string `envconfig:"WEBHOOK_PATH" default:"/telegram/webhook"`
+	WebhookSecret string `envconfig:"WEBHOOK_SECRET"` // 1-256 символов: A-Z, a-z, 0-9, _ и -
+
+	// Сколько ждать завершения запущенных задач при остановке, прежде чем прервать их
+	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"5m"`
+
+	// Длинные результаты: сообщения делятся на части, а текст длиннее MESSAGE_FILE_THRESHOLD символов
+	// (0 - без ограничения) дополнительно прикладывается файлом .txt или .md
+	MessageFileThreshold int    `envconfig:"MESSAGE_FILE_THRESHOLD" default:"12000"`
+	MessageFileFormat    string `envconfig:"MESSAGE_FILE_FORMAT" default:"txt"`
+
+	// Число воркеров очереди задач (обработка YouTube-видео)
+	QueueWorkers int `envconfig:"QUEUE_WORKERS" default:"3"`
 }
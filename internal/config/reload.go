@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/kelseyhightower/envconfig"
+)
+
+// Переменные окружения процесса на момент запуска: при перечитывании .env они, как и при старте,
+// имеют приоритет над значениями из файла
+var processEnv = envNames(os.Environ())
+
+// Reload перечитывает .env и окружение и возвращает новую конфигурацию; текущая не меняется.
+// Переменные, удаленные из .env, возвращаются к значениям по умолчанию.
+func Reload() (*Config, error) {
+	values, err := godotenv.Read(".env")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read .env: %w", err)
+	}
+	// Все, чего не было в окружении процесса, взято из .env при запуске или прошлом перечитывании
+	for name := range envNames(os.Environ()) {
+		if processEnv[name] {
+			continue
+		}
+		if _, ok := values[name]; !ok {
+			if err := os.Unsetenv(name); err != nil {
+				return nil, fmt.Errorf("failed to unset %s: %w", name, err)
+			}
+		}
+	}
+	for name, value := range values {
+		if processEnv[name] {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", name, err)
+		}
+	}
+
+	cfg := &Config{}
+	if err := envconfig.Process("", cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Changed возвращает имена переменных окружения, значения которых в old и cfg различаются
+func Changed(old, cfg *Config) []string {
+	var names []string
+	walkFields(reflect.ValueOf(old).Elem(), reflect.ValueOf(cfg).Elem(), func(name string, oldField, field reflect.Value) {
+		if !reflect.DeepEqual(oldField.Interface(), field.Interface()) {
+			names = append(names, name)
+		}
+	})
+	return names
+}
+
+// Restore возвращает в cfg значения из old для переменных names, например для настроек,
+// которые применяются только при запуске
+func Restore(cfg, old *Config, names []string) {
+	walkFields(reflect.ValueOf(old).Elem(), reflect.ValueOf(cfg).Elem(), func(name string, oldField, field reflect.Value) {
+		if slices.Contains(names, name) {
+			field.Set(oldField)
+		}
+	})
+}
+
+// walkFields обходит поля конфигурации с тегом envconfig, включая встроенные структуры
+func walkFields(old, cfg reflect.Value, fn func(name string, oldField, field reflect.Value)) {
+	for i := 0; i < old.NumField(); i++ {
+		field := old.Type().Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			walkFields(old.Field(i), cfg.Field(i), fn)
+			continue
+		}
+		if name := field.Tag.Get("envconfig"); name != "" {
+			fn(name, old.Field(i), cfg.Field(i))
+		}
+	}
+}
+
+func envNames(environ []string) map[string]bool {
+	names := make(map[string]bool, len(environ))
+	for _, entry := range environ {
+		name, _, _ := strings.Cut(entry, "=")
+		names[name] = true
+	}
+	return names
+}
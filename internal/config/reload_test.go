@@ -0,0 +1,102 @@
+package config
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+// clearEnv очищает переменные на время теста и восстанавливает их после
+func clearEnv(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func writeEnvFile(t *testing.T, content string) {
+	t.Helper()
+	if err := os.WriteFile(".env", []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	t.Chdir(t.TempDir())
+	clearEnv(t, "PLAYLIST_MAX_VIDEOS", "BROADCAST_INTERVAL", "QUOTA_SUMMARIES_PER_HOUR")
+
+	writeEnvFile(t, "PLAYLIST_MAX_VIDEOS=5\nBROADCAST_INTERVAL=1s\n")
+	cfg, err := Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PlaylistMaxVideos != 5 || cfg.BroadcastInterval != time.Second {
+		t.Errorf("Reload() = %d, %v, want values from .env", cfg.PlaylistMaxVideos, cfg.BroadcastInterval)
+	}
+
+	// Переменная, удаленная из .env, возвращается к значению по умолчанию
+	writeEnvFile(t, "BROADCAST_INTERVAL=2s\n")
+	cfg, err = Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PlaylistMaxVideos != 20 {
+		t.Errorf("PlaylistMaxVideos after removal from .env = %d, want default 20", cfg.PlaylistMaxVideos)
+	}
+	if cfg.BroadcastInterval != 2*time.Second {
+		t.Errorf("BroadcastInterval = %v, want 2s", cfg.BroadcastInterval)
+	}
+
+	// Окружение процесса важнее .env
+	processEnv["QUOTA_SUMMARIES_PER_HOUR"] = true
+	t.Cleanup(func() { delete(processEnv, "QUOTA_SUMMARIES_PER_HOUR") })
+	os.Setenv("QUOTA_SUMMARIES_PER_HOUR", "7")
+	writeEnvFile(t, "QUOTA_SUMMARIES_PER_HOUR=3\n")
+	cfg, err = Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.QuotaSummariesPerHour != 7 {
+		t.Errorf("QuotaSummariesPerHour = %d, want 7 from process environment", cfg.QuotaSummariesPerHour)
+	}
+
+	// Без .env остаются значения по умолчанию
+	if err := os.Remove(".env"); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BroadcastInterval != 100*time.Millisecond {
+		t.Errorf("BroadcastInterval without .env = %v, want default 100ms", cfg.BroadcastInterval)
+	}
+}
+
+func TestChangedAndRestore(t *testing.T) {
+	old := &Config{PlaylistMaxVideos: 20, AdminIDs: []int64{1}, BroadcastInterval: time.Second}
+	old.App.Addr = "0.0.0.0:9000"
+	cfg := &Config{PlaylistMaxVideos: 5, AdminIDs: []int64{1, 2}, BroadcastInterval: time.Second}
+	cfg.App.Addr = "0.0.0.0:9100"
+
+	want := []string{"APP_ADDR", "ADMIN_IDS", "PLAYLIST_MAX_VIDEOS"}
+	got := Changed(old, cfg)
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("Changed() = %v, want %v", got, want)
+	}
+	if changed := Changed(old, old); len(changed) != 0 {
+		t.Errorf("Changed(old, old) = %v, want none", changed)
+	}
+
+	Restore(cfg, old, []string{"APP_ADDR", "PLAYLIST_MAX_VIDEOS"})
+	if cfg.App.Addr != old.App.Addr || cfg.PlaylistMaxVideos != 20 {
+		t.Errorf("Restore() left %q, %d", cfg.App.Addr, cfg.PlaylistMaxVideos)
+	}
+	if len(cfg.AdminIDs) != 2 {
+		t.Errorf("Restore() changed ADMIN_IDS, which was not requested")
+	}
+}
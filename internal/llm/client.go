@@ -0,0 +1,138 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"main/internal/metrics"
+	"main/internal/model"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const BothubChatCompletionsURL = "https://bothub.chat/api/v2/openai/v1/chat/completions"
+
+// UsageHook вызывается после каждого успешного запроса с расходом токенов. ctx - контекст запроса,
+// по нему вызывающий код определяет, кому отнести расход.
+type UsageHook func(ctx context.Context, modelName string, usage model.TokenUsage)
+
+// Client клиент OpenAI-совместимого API /chat/completions (по умолчанию Bothub)
+type Client struct {
+	url      string
+	provider string // хост API, метка provider в метриках
+	token    string
+	client   *http.Client
+	onUsage  UsageHook
+}
+
+func NewClient(apiURL, token string) *Client {
+	if apiURL == "" {
+		apiURL = BothubChatCompletionsURL
+	}
+	provider := apiURL
+	if parsed, err := url.Parse(apiURL); err == nil && parsed.Host != "" {
+		provider = parsed.Host
+	}
+	return &Client{
+		url:      apiURL,
+		provider: provider,
+		token:    token,
+		client:   &http.Client{Timeout: 120 * time.Second}, // Таймаут для LLM может быть длинным
+	}
+}
+
+// OnUsage задает обработчик расхода токенов; вызывать до первого запроса
+func (c *Client) OnUsage(hook UsageHook) {
+	c.onUsage = hook
+}
+
+// Complete отправляет сообщения модели и возвращает текст первого варианта ответа
+func (c *Client) Complete(ctx context.Context, modelName string, messages []model.ChatMessage) (string, error) {
+	start := time.Now()
+	content, err := c.complete(ctx, modelName, messages)
+	metrics.ObserveSince(metrics.LLMDuration.WithLabelValues(modelName, metrics.Result(err)), start)
+	return content, err
+}
+
+func (c *Client) complete(ctx context.Context, modelName string, messages []model.ChatMessage) (string, error) {
+	requestPayload := model.ChatCompletionRequest{
+		Model:    modelName,
+		Messages: messages,
+	}
+
+	requestBodyBytes, err := json.Marshal(requestPayload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal chat completion request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewBuffer(requestBodyBytes))
+	if err != nil {
+		return "", fmt.Errorf("failed to create new HTTP request for chat completion: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		metrics.APIResponses.WithLabelValues("chat", c.provider, "error").Inc()
+		return "", fmt.Errorf("failed to execute HTTP request to Bothub Chat API: %w", err)
+	}
+	defer resp.Body.Close()
+	metrics.APIResponses.WithLabelValues("chat", c.provider, strconv.Itoa(resp.StatusCode)).Inc()
+
+	responseBodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body from Bothub Chat API: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Bothub Chat API returned non-OK status: %s. Response: %s", resp.Status, string(responseBodyBytes))
+		var errorResp model.ChatCompletionResponse
+		if json.Unmarshal(responseBodyBytes, &errorResp) == nil && errorResp.Error != nil {
+			return "", fmt.Errorf("Bothub Chat API error: %s (Type: %s, Code: %s, Param: %s), HTTP Status: %s",
+				errorResp.Error.Message, errorResp.Error.Type, errorResp.Error.Code, errorResp.Error.Param, resp.Status)
+		}
+		return "", fmt.Errorf("Bothub Chat API request failed with status %s and body: %s", resp.Status, string(responseBodyBytes))
+	}
+
+	var chatResponse model.ChatCompletionResponse
+	err = json.Unmarshal(responseBodyBytes, &chatResponse)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal JSON response from Bothub Chat API (%s): %w. Response body: %s", resp.Status, err, string(responseBodyBytes))
+	}
+
+	if chatResponse.Error != nil {
+		return "", fmt.Errorf("Bothub Chat API returned an error in JSON response: %s (Type: %s)", chatResponse.Error.Message, chatResponse.Error.Type)
+	}
+
+	if len(chatResponse.Choices) == 0 || chatResponse.Choices[0].Message.Content == "" {
+		log.Printf("Warning: Bothub Chat API returned OK status but no content. Response: %s", string(responseBodyBytes))
+		return "", fmt.Errorf("Bothub Chat API returned no content in response. Response body: %s", string(responseBodyBytes))
+	}
+
+	log.Printf("Bothub Chat API successfully returned completion.")
+	content := chatResponse.Choices[0].Message.Content
+	if c.onUsage != nil {
+		usage := model.TokenUsage{}
+		if chatResponse.Usage != nil {
+			usage = *chatResponse.Usage
+		} else {
+			// Не все OpenAI-совместимые API возвращают usage - оцениваем по длине текста
+			contents := make([]string, len(messages))
+			for i, message := range messages {
+				contents[i] = message.Content
+			}
+			usage.PromptTokens = EstimateMessagesTokens(contents...)
+			usage.CompletionTokens = EstimateTokens(content)
+			usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		}
+		c.onUsage(ctx, modelName, usage)
+	}
+	return content, nil
+}
@@ -0,0 +1,18 @@
+package llm
+
+import "unicode/utf8"
+
+// EstimateTokens грубо оценивает число токенов без токенизатора.
+// Для кириллицы токен в среднем короче, чем для латиницы, поэтому берем ~3 символа на токен с запасом.
+func EstimateTokens(text string) int {
+	return utf8.RuneCountInString(text)/3 + 1
+}
+
+// EstimateMessagesTokens оценивает размер списка сообщений с учетом служебных токенов на каждое сообщение
+func EstimateMessagesTokens(contents ...string) int {
+	total := 0
+	for _, content := range contents {
+		total += EstimateTokens(content) + 4
+	}
+	return total
+}
@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"io/fs"
+	"log"
+	"main/internal/model"
+	"main/internal/storage"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "audiobot"
+
+var (
+	// Updates обновления Telegram по типу: command, text, voice, audio, video, video_note, document, callback_query, other
+	Updates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "updates_total",
+		Help:      "Telegram updates received, by type.",
+	}, []string{"type"})
+
+	// DownloadDuration скачивание медиафайлов: source - telegram, ytdlp или direct
+	DownloadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "download_duration_seconds",
+		Help:      "Time spent downloading media, by source and result.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 13),
+	}, []string{"source", "result"})
+
+	// FFmpegDuration вызовы ffmpeg и ffprobe: operation - convert_wav, convert_mp3, extract, duration, silence
+	FFmpegDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ffmpeg_duration_seconds",
+		Help:      "Time spent in ffmpeg and ffprobe, by operation and result.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 13),
+	}, []string{"operation", "result"})
+
+	// STTDuration распознавание файла целиком, включая нарезку на фрагменты
+	STTDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "stt_duration_seconds",
+		Help:      "Speech recognition latency for a whole file, by provider and result.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"provider", "result"})
+
+	// LLMDuration запросы к /chat/completions
+	LLMDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_duration_seconds",
+		Help:      "Chat completion request latency, by model and result.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 10),
+	}, []string{"model", "result"})
+
+	// APIResponses HTTP-ответы внешних API (Bothub и OpenAI-совместимых): api - chat или transcriptions,
+	// code - HTTP-статус или "error", если ответа не было
+	APIResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_responses_total",
+		Help:      "HTTP responses from chat completion and transcription APIs, by API, provider and status code.",
+	}, []string{"api", "provider", "code"})
+
+	// Семафор ограничивает число одновременно обрабатываемых сообщений
+	SemaphoreInUse = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "semaphore_in_use",
+		Help:      "Messages currently being handled.",
+	})
+	SemaphoreCapacity = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "semaphore_capacity",
+		Help:      "Maximum number of messages handled concurrently.",
+	})
+	SemaphoreWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "semaphore_wait_seconds",
+		Help:      "Time a message waited for a free handler slot.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 8),
+	})
+)
+
+// Result значение метки result
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// ObserveSince записывает в гистограмму время, прошедшее с start
+func ObserveSince(observer prometheus.Observer, start time.Time) {
+	observer.Observe(time.Since(start).Seconds())
+}
+
+// Handler HTTP-обработчик /metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RegisterQueue добавляет глубину очереди задач по статусам; значения читаются из хранилища при каждом запросе /metrics,
+// поэтому показывают очередь всех реплик
+func RegisterQueue(repo storage.JobRepository) {
+	prometheus.MustRegister(&queueCollector{
+		repo: repo,
+		desc: prometheus.NewDesc(namespace+"_queue_jobs", "Unfinished jobs in the persistent queue, by status.", []string{"status"}, nil),
+	})
+}
+
+type queueCollector struct {
+	repo storage.JobRepository
+	desc *prometheus.Desc
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	jobs, err := c.repo.ListJobsByStatus(model.JobPendingStatuses...)
+	if err != nil {
+		log.Printf("Metrics: failed to list jobs: %v", err)
+		return
+	}
+	counts := make(map[string]int, len(model.JobPendingStatuses))
+	for _, job := range jobs {
+		counts[job.Status]++
+	}
+	for _, status := range model.JobPendingStatuses {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(counts[status]), status)
+	}
+}
+
+// RegisterTempDisk добавляет объем временных файлов и каталогов, подходящих под glob-шаблоны patterns
+func RegisterTempDisk(patterns ...string) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "temp_disk_bytes",
+		Help:      "Disk space used by temporary media files.",
+	}, func() float64 {
+		var total int64
+		for _, pattern := range patterns {
+			paths, err := filepath.Glob(pattern)
+			if err != nil {
+				continue
+			}
+			for _, path := range paths {
+				total += diskUsage(path)
+			}
+		}
+		return float64(total)
+	})
+}
+
+// diskUsage размер файла или суммарный размер файлов каталога; файлы могут удаляться во время обхода
+func diskUsage(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+const (
+	AccessSubjectUser = "user"
+	AccessSubjectChat = "chat" // группа: бот доступен всем ее участникам
+)
+
+// Invite одноразовый код приглашения, который пользователь активирует командой /start <код>
+type Invite struct {
+	Code      string
+	CreatedBy int64
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedBy    int64 // 0 - код еще не использован
+	UsedAt    time.Time
+}
+
+// Ban блокировка пользователя администратором: бот не отвечает ему, даже если он есть в списке доступа
+type Ban struct {
+	UserID    int64
+	BannedBy  int64
+	Reason    string
+	CreatedAt time.Time
+}
@@ -25,16 +25,35 @@ type ChatCompletionResponse struct {
 		Param   string `json:"param"`
 		Code    string `json:"code"`
 	} `json:"error,omitempty"`
-	// Можно добавить другие поля если нужно, например, Usage
+	Usage *TokenUsage `json:"usage,omitempty"`
 }
 
-// Структура для разбора JSON-ответа от API распознавания речи
+// TokenUsage расход токенов на один запрос к модели
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Структура для разбора JSON-ответа от API распознавания речи.
+// Language, Duration и Segments заполняются при response_format=verbose_json
 type TranscriptionResponse struct {
-	Text  string `json:"text"`
-	Error *struct {
+	Text     string                 `json:"text"`
+	Language string                 `json:"language,omitempty"`
+	Duration float64                `json:"duration,omitempty"`
+	Segments []TranscriptionSegment `json:"segments,omitempty"`
+	Error    *struct {
 		Message string `json:"message"`
 		Type    string `json:"type"`
 		Param   string `json:"param"`
 		Code    string `json:"code"`
 	} `json:"error,omitempty"`
 }
+
+// Фрагмент распознанного текста с временем начала и конца в секундах
+type TranscriptionSegment struct {
+	ID    int     `json:"id"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
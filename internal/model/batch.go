@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+const (
+	JobKindDigest = "digest" // общий дайджест плейлиста по результатам его видео
+
+	BatchStatusPending   = "pending"  // видео перечислены, ждем подтверждения пользователя
+	BatchStatusQueueing  = "queueing" // задачи видео ставятся в очередь
+	BatchStatusRunning   = "running"
+	BatchStatusDone      = "done"
+	BatchStatusCancelled = "cancelled"
+)
+
+// Batch пакетная обработка плейлиста или канала: каждое видео - отдельная задача с BatchID
+type Batch struct {
+	ID                int64
+	UserID            int64
+	ChatID            int64
+	MessageID         int // сообщение пользователя со ссылкой
+	ProgressMessageID int // сообщение бота с общим прогрессом
+	Source            string
+	Title             string
+	Entries           []BatchEntry
+	Digest            bool // после обработки всех видео составить общий дайджест
+	Status            string
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// BatchEntry видео из плейлиста
+type BatchEntry struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+}
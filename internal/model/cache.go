@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// CachedTranscript транскрипт видео, общий для всех пользователей: повторная ссылка на то же видео
+// не скачивается и не распознается заново
+type CachedTranscript struct {
+	VideoID   string // канонический идентификатор, см. source.Source.VideoID
+	Language  string // язык распознавания из настроек; пустой - автоопределение
+	Source    string // откуда взят текст ("аудиодорожки", "субтитров YouTube, язык en")
+	Metadata  VideoMetadata
+	Text      string
+	Duration  float64
+	Segments  []TranscriptionSegment
+	CreatedAt time.Time
+}
+
+// CachedSummary результат нейросети для кэшированного транскрипта. Variant описывает параметры
+// запроса (пресет, модель, язык, стиль): при других параметрах результат строится заново.
+type CachedSummary struct {
+	VideoID   string
+	Language  string
+	Variant   string
+	Summary   string
+	CreatedAt time.Time
+}
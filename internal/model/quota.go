@@ -0,0 +1,14 @@
+package model
+
+const (
+	// Виды расхода квот
+	QuotaUsageAudioSeconds = "audio_seconds" // секунды распознанного аудио
+	QuotaUsageSummary      = "summary"       // запрос на обработку видео по ссылке
+)
+
+// QuotaLimits лимиты пользователя; 0 - без ограничения
+type QuotaLimits struct {
+	AudioMinutesPerDay int
+	SummariesPerHour   int
+	MaxDurationMinutes int // максимальная длительность одного файла или видео
+}
@@ -0,0 +1,17 @@
+package model
+
+const (
+	OutputFormatText = "text"
+	OutputFormatFile = "file"
+)
+
+// UserSettings пользовательские настройки из меню "⚙️ Настройки".
+// Пустое значение поля означает значение по умолчанию.
+type UserSettings struct {
+	TranscriptionLanguage string `json:"transcription_language"` // "" - автоопределение
+	SummaryLanguage       string `json:"summary_language"`
+	SummaryStyle          string `json:"summary_style"`
+	PromptPreset          string `json:"prompt_preset"` // имя пресета шаблонов запросов
+	OutputFormat          string `json:"output_format"`
+	ChatModel             string `json:"chat_model"`
+}
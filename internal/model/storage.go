@@ -0,0 +1,68 @@
+package model
+
+import "time"
+
+// User пользователь Telegram, который писал боту
+type User struct {
+	ID        int64
+	UserName  string
+	FirstName string
+	LastName  string
+	CreatedAt time.Time
+	LastSeen  time.Time
+}
+
+const (
+	JobKindURL     = "url"     // видео или аудио по ссылке
+	JobKindYoutube = "youtube" // задачи, созданные до поддержки других площадок; обрабатываются как url
+
+	JobStatusQueued       = "queued"
+	JobStatusDownloading  = "downloading"
+	JobStatusTranscribing = "transcribing"
+	JobStatusSummarizing  = "summarizing"
+	JobStatusDone         = "done"
+	JobStatusFailed       = "failed"
+	JobStatusCancelled    = "cancelled"
+)
+
+// JobActiveStatuses статусы задач, которые сейчас выполняются воркером
+var JobActiveStatuses = []string{JobStatusDownloading, JobStatusTranscribing, JobStatusSummarizing}
+
+// JobPendingStatuses статусы незавершенных задач: ждущие в очереди и выполняющиеся
+var JobPendingStatuses = append([]string{JobStatusQueued}, JobActiveStatuses...)
+
+// Job задача на обработку (например, YouTube-видео)
+type Job struct {
+	ID                int64
+	UserID            int64
+	ChatID            int64
+	MessageID         int // исходное сообщение пользователя
+	ProgressMessageID int // сообщение бота, в котором показывается прогресс
+	Kind              string
+	Source            string // ссылка или file_id
+	Status            string
+	Error             string
+	CancelRequested   bool    // пользователь запросил отмену; воркер проверяет флаг и прерывает задачу
+	Refresh           bool    // не брать результат из кэша, а обработать заново
+	RangeStart        float64 // фрагмент видео в секундах; 0 - с начала
+	RangeEnd          float64 // 0 - до конца
+	BatchID           int64   // пакет (плейлист), в который входит задача; 0 - отдельная задача
+	Result            string  // итоговый текст для дайджеста плейлиста
+	Attempt           int     // номер захвата воркером; меняется, если задачу вернули в очередь и забрали снова
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// StoredTranscript сохраненный результат распознавания, привязанный к исходному сообщению
+type StoredTranscript struct {
+	ID        int64
+	UserID    int64
+	ChatID    int64
+	MessageID int
+	Source    string
+	Language  string
+	Duration  float64
+	Text      string
+	Segments  []TranscriptionSegment
+	CreatedAt time.Time
+}
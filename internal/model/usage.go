@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+const (
+	// Виды платных запросов в учете расхода
+	UsageKindLLM = "llm" // запрос к нейросети, расход в токенах
+	UsageKindSTT = "stt" // распознавание речи, расход в секундах аудио
+)
+
+// UsageRecord расход одного запроса к платному API, привязанный к пользователю и чату
+type UsageRecord struct {
+	ID               int64
+	UserID           int64
+	ChatID           int64
+	Kind             string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	AudioSeconds     float64
+	CreatedAt        time.Time
+}
+
+// UsageTotal суммарный расход пользователя по одной модели
+type UsageTotal struct {
+	UserID           int64
+	Kind             string
+	Model            string
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	AudioSeconds     float64
+}
@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// VideoMetadata сведения о видео из yt-dlp --dump-json
+type VideoMetadata struct {
+	ID          string
+	Title       string
+	Channel     string
+	Duration    float64 // секунды
+	UploadDate  time.Time
+	Description string
+	Chapters    []VideoChapter
+}
+
+// VideoChapter глава видео (таймкоды из описания или разметки автора)
+type VideoChapter struct {
+	Title string
+	Start float64
+	End   float64
+}
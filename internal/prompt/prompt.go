@@ -0,0 +1,186 @@
+package prompt
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates
+var builtinFS embed.FS
+
+const (
+	presetExtension = ".tmpl"
+
+	// Шаблоны запросов, которые использует суммаризатор
+	BlockSingle  = "single"  // транскрипт целиком
+	BlockSection = "section" // часть длинного транскрипта
+	BlockMerge   = "merge"   // промежуточное объединение частей
+	BlockFinal   = "final"   // итоговое объединение частей
+	// Дайджест плейлиста по результатам отдельных видео
+	BlockDigest      = "digest"
+	BlockDigestMerge = "digest_merge"
+)
+
+// Data переменные шаблона
+type Data struct {
+	Title               string // название видео (для дайджеста - плейлиста), если известно
+	Channel             string
+	UploadDate          string // дата публикации в формате 02.01.2006
+	Description         string // описание видео (обрезанное)
+	Duration            string // длительность в формате m:ss или h:mm:ss, если известна
+	Language            string // код языка ответа
+	LanguageInstruction string // "отвечай на ... языке"
+	Style               string // описание стиля из настроек пользователя
+	Transcript          string // транскрипт, его часть или краткие содержания частей
+	Part                int
+	Total               int
+	Label               string // таймкоды части, например "[12:30–25:00]"
+	Chapter             string // название главы видео, если части построены по главам
+}
+
+// Preset именованный набор шаблонов запросов
+type Preset struct {
+	Name  string
+	Title string
+	tmpl  *template.Template
+}
+
+// Render выполняет шаблон block пресета
+func (p *Preset) Render(block string, data Data) (string, error) {
+	var sb strings.Builder
+	if err := p.tmpl.ExecuteTemplate(&sb, block, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt %s/%s: %w", p.Name, block, err)
+	}
+	return sb.String(), nil
+}
+
+// Library встроенные пресеты и пресеты из каталога конфигурации. Файл <name>.tmpl из каталога
+// добавляет новый пресет или заменяет встроенный с тем же именем.
+type Library struct {
+	presets     map[string]*Preset
+	defaultName string
+}
+
+// Load загружает пресеты; отсутствующий каталог dir не считается ошибкой
+func Load(dir string, defaultName string) (*Library, error) {
+	baseContent, err := builtinFS.ReadFile("templates/base.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read base prompt template: %w", err)
+	}
+	base, err := template.New("base").Parse(string(baseContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse base prompt template: %w", err)
+	}
+
+	library := &Library{presets: make(map[string]*Preset), defaultName: defaultName}
+	builtin, err := fs.Sub(builtinFS, "templates/presets")
+	if err != nil {
+		return nil, err
+	}
+	if err := library.loadFS(base, builtin); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if _, err := os.Stat(dir); err == nil {
+			if err := library.loadFS(base, os.DirFS(dir)); err != nil {
+				return nil, fmt.Errorf("failed to load prompt templates from %s: %w", dir, err)
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to open prompt templates directory %s: %w", dir, err)
+		}
+	}
+
+	if _, ok := library.presets[defaultName]; !ok {
+		return nil, fmt.Errorf("default prompt preset %q not found", defaultName)
+	}
+	return library, nil
+}
+
+func (l *Library) loadFS(base *template.Template, fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*"+presetExtension)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(file), presetExtension)
+		preset, err := parsePreset(base, name, string(content))
+		if err != nil {
+			return err
+		}
+		if _, exists := l.presets[name]; exists {
+			log.Printf("Prompt preset %q overridden by %s", name, file)
+		}
+		l.presets[name] = preset
+	}
+	return nil
+}
+
+func parsePreset(base *template.Template, name, content string) (*Preset, error) {
+	tmpl, err := base.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmpl.Parse(content); err != nil {
+		return nil, fmt.Errorf("failed to parse prompt preset %s: %w", name, err)
+	}
+	preset := &Preset{Name: name, tmpl: tmpl}
+
+	// Проверяем шаблоны сразу, чтобы ошибка в пресете обнаружилась при запуске, а не на запросе пользователя
+	sample := Data{Title: "...", Channel: "...", Description: "...", Transcript: "...", Part: 1, Total: 2, Chapter: "..."}
+	for _, block := range []string{BlockSingle, BlockSection, BlockMerge, BlockFinal, BlockDigest, BlockDigestMerge} {
+		if _, err := preset.Render(block, sample); err != nil {
+			return nil, err
+		}
+	}
+	title, err := preset.Render("title", Data{})
+	if err != nil {
+		return nil, err
+	}
+	preset.Title = strings.TrimSpace(title)
+	if preset.Title == "" {
+		preset.Title = name
+	}
+	return preset, nil
+}
+
+// Get возвращает пресет по имени; для пустого или неизвестного имени - пресет по умолчанию
+func (l *Library) Get(name string) *Preset {
+	if preset, ok := l.presets[name]; ok {
+		return preset
+	}
+	return l.presets[l.defaultName]
+}
+
+// Default возвращает пресет по умолчанию
+func (l *Library) Default() *Preset {
+	return l.presets[l.defaultName]
+}
+
+// Presets возвращает пресеты: сначала пресет по умолчанию, затем остальные по имени
+func (l *Library) Presets() []*Preset {
+	names := make([]string, 0, len(l.presets))
+	for name := range l.presets {
+		if name != l.defaultName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	presets := []*Preset{l.presets[l.defaultName]}
+	for _, name := range names {
+		presets = append(presets, l.presets[name])
+	}
+	return presets
+}
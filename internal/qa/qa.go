@@ -0,0 +1,186 @@
+package qa
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"main/internal/llm"
+	"main/internal/model"
+	"main/internal/summary"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// Запас токенов на инструкцию и ответ модели
+	promptReserveTokens = 1000
+	// Размер фрагмента транскрипта, по которым ищутся относящиеся к вопросу места
+	excerptSectionTokens = 1500
+	// Слова короче не участвуют в поиске; длинные слова сравниваются по началу (грубая замена стемминга)
+	minTermLength = 3
+	termPrefix    = 6
+)
+
+// Options параметры ответа; пустые поля заменяются значениями по умолчанию
+type Options struct {
+	Model    string
+	Language string
+}
+
+// Assistant отвечает на вопросы по транскрипту с учетом истории диалога. В запрос попадает
+// системный промпт с транскриптом (или относящимися к вопросу фрагментами, если он не помещается),
+// история, урезанная до бюджета токенов, и сам вопрос.
+type Assistant struct {
+	client         *llm.Client
+	model          string
+	maxInputTokens int
+	historyTokens  int
+}
+
+func NewAssistant(client *llm.Client, modelName string, maxInputTokens, historyTokens int) *Assistant {
+	if maxInputTokens < 2*promptReserveTokens {
+		maxInputTokens = 2 * promptReserveTokens
+	}
+	budget := maxInputTokens - promptReserveTokens
+	if historyTokens < 0 || historyTokens > budget/2 {
+		historyTokens = budget / 2
+	}
+	return &Assistant{
+		client:         client,
+		model:          modelName,
+		maxInputTokens: maxInputTokens,
+		historyTokens:  historyTokens,
+	}
+}
+
+// Answer отвечает на вопрос и возвращает ответ вместе с обновленной историей (без системного промпта)
+func (a *Assistant) Answer(ctx context.Context, transcript *model.StoredTranscript, history []model.ChatMessage, question string, opts Options) (string, []model.ChatMessage, error) {
+	if opts.Model == "" {
+		opts.Model = a.model
+	}
+
+	history = TrimHistory(history, a.historyTokens)
+	used := llm.EstimateMessagesTokens(question) + llm.EstimateMessagesTokens(systemPrompt("", opts))
+	for _, message := range history {
+		used += llm.EstimateMessagesTokens(message.Content)
+	}
+	excerpt := Excerpt(transcript, question+" "+lastUserQuestion(history), a.maxInputTokens-promptReserveTokens-used)
+
+	messages := make([]model.ChatMessage, 0, len(history)+2)
+	messages = append(messages, model.ChatMessage{Role: "system", Content: systemPrompt(excerpt, opts)})
+	messages = append(messages, history...)
+	messages = append(messages, model.ChatMessage{Role: "user", Content: question})
+
+	log.Printf("Answering question about transcript %d (history: %d messages): %.80s", transcript.ID, len(history), question)
+	answer, err := a.client.Complete(ctx, opts.Model, messages)
+	if err != nil {
+		return "", history, fmt.Errorf("failed to answer question: %w", err)
+	}
+
+	history = append(history,
+		model.ChatMessage{Role: "user", Content: question},
+		model.ChatMessage{Role: "assistant", Content: answer},
+	)
+	return answer, TrimHistory(history, a.historyTokens), nil
+}
+
+// TrimHistory удаляет самые старые сообщения, пока история не уложится в maxTokens.
+// История всегда начинается с вопроса пользователя либо с исходного ответа бота.
+func TrimHistory(history []model.ChatMessage, maxTokens int) []model.ChatMessage {
+	total := 0
+	for _, message := range history {
+		total += llm.EstimateMessagesTokens(message.Content)
+	}
+	start := 0
+	for start < len(history) && total > maxTokens {
+		total -= llm.EstimateMessagesTokens(history[start].Content)
+		start++
+	}
+	// Не оставляем ответ без вопроса, на который он был дан
+	for start < len(history) && start > 0 && history[start].Role == "assistant" {
+		start++
+	}
+	return history[start:]
+}
+
+// Excerpt возвращает транскрипт целиком, если он укладывается в maxTokens, иначе - фрагменты
+// с наибольшим числом совпадающих с запросом слов, в исходном порядке и с таймкодами
+func Excerpt(transcript *model.StoredTranscript, query string, maxTokens int) string {
+	if llm.EstimateTokens(transcript.Text) <= maxTokens {
+		return transcript.Text
+	}
+
+	sections := summary.SplitSections(transcript.Text, transcript.Segments, excerptSectionTokens)
+	queryTerms := terms(query)
+	scores := make([]int, len(sections))
+	for i, section := range sections {
+		for term := range terms(section.Text) {
+			if queryTerms[term] {
+				scores[i]++
+			}
+		}
+	}
+
+	order := make([]int, len(sections))
+	for i := range order {
+		order[i] = i
+	}
+	// При равном счете предпочитаем начало: там обычно вводная часть с темой
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+
+	var chosen []int
+	used := 0
+	for _, i := range order {
+		cost := llm.EstimateTokens(sections[i].Text) + 10
+		if used+cost > maxTokens {
+			continue
+		}
+		chosen = append(chosen, i)
+		used += cost
+	}
+	sort.Ints(chosen)
+
+	parts := make([]string, 0, len(chosen))
+	for _, i := range chosen {
+		part := sections[i].Text
+		if label := sections[i].Label(); label != "" {
+			part = label + " " + part
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "\n…\n")
+}
+
+func terms(text string) map[string]bool {
+	result := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		runes := []rune(word)
+		if len(runes) < minTermLength {
+			continue
+		}
+		if len(runes) > termPrefix {
+			runes = runes[:termPrefix]
+		}
+		result[string(runes)] = true
+	}
+	return result
+}
+
+func lastUserQuestion(history []model.ChatMessage) string {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "user" {
+			return history[i].Content
+		}
+	}
+	return ""
+}
+
+func systemPrompt(excerpt string, opts Options) string {
+	return fmt.Sprintf("Ты помогаешь пользователю разобраться в содержании аудиозаписи или видео. "+
+		"Отвечай на вопросы, опираясь только на расшифровку ниже; если ответа в ней нет, так и скажи. "+
+		"Ссылайся на таймкоды в квадратных скобках, если они есть (%s).\n\nРасшифровка:\n\"%s\"",
+		summary.LanguageInstruction(opts.Language), excerpt)
+}
@@ -0,0 +1,70 @@
+package qa
+
+import (
+	"main/internal/model"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTrimHistory(t *testing.T) {
+	// Каждое сообщение - 9 символов, то есть 8 токенов с учетом служебных
+	history := []model.ChatMessage{
+		{Role: "assistant", Content: "summary.."},
+		{Role: "user", Content: "question1"},
+		{Role: "assistant", Content: "answer1.."},
+		{Role: "user", Content: "question2"},
+		{Role: "assistant", Content: "answer2.."},
+	}
+	tests := []struct {
+		name      string
+		maxTokens int
+		wantStart int
+	}{
+		{"fits", 40, 0},
+		{"oldest dropped", 39, 1},
+		{"answer without question dropped", 31, 3},
+		{"last exchange", 16, 3},
+		{"nothing fits", 0, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TrimHistory(history, tt.maxTokens)
+			if want := history[tt.wantStart:]; !reflect.DeepEqual(got, want) {
+				t.Errorf("TrimHistory(%d) = %v, want %v", tt.maxTokens, got, want)
+			}
+		})
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	// Каждый фрагмент длиннее половины excerptSectionTokens, поэтому становится отдельным разделом
+	topics := []string{"кошки мяукают ", "собаки лают ", "погода меняется "}
+	var segments []model.TranscriptionSegment
+	var texts []string
+	for i, topic := range topics {
+		text := strings.TrimSpace(strings.Repeat(topic, 4200/len([]rune(topic))))
+		segments = append(segments, model.TranscriptionSegment{Start: float64(i * 60), End: float64(i*60 + 60), Text: text})
+		texts = append(texts, text)
+	}
+	transcript := &model.StoredTranscript{Text: strings.Join(texts, " "), Segments: segments}
+
+	tests := []struct {
+		name      string
+		query     string
+		maxTokens int
+		want      string
+	}{
+		{"whole transcript fits", "собаки", 10000, transcript.Text},
+		{"best section", "что там про собаки", 1500, "[1:00–2:00] " + texts[1]},
+		{"ties prefer beginning", "о чем видео", 1500, "[0:00–1:00] " + texts[0]},
+		{"chosen sections in original order", "погода и кошки", 3000, "[0:00–1:00] " + texts[0] + "\n…\n[2:00–3:00] " + texts[2]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Excerpt(transcript, tt.query, tt.maxTokens); got != tt.want {
+				t.Errorf("Excerpt(%q, %d) = %.80q..., want %.80q...", tt.query, tt.maxTokens, got, tt.want)
+			}
+		})
+	}
+}
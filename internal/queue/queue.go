@@ -0,0 +1,310 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"main/internal/model"
+	"main/internal/storage"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	pollInterval      = 5 * time.Second
+	heartbeatInterval = 30 * time.Second
+	// Как часто выполняющаяся задача проверяет флаг отмены в хранилище
+	// (отмену могли запросить через другой экземпляр бота)
+	cancelCheckInterval = 5 * time.Second
+	// Задача в активном статусе без heartbeat дольше staleAfter считается брошенной
+	// (процесс упал или был убит) и возвращается в очередь
+	staleAfter = 3 * heartbeatInterval
+)
+
+// ErrCancelled причина отмены контекста задачи, если ее отменил пользователь
+var ErrCancelled = errors.New("job cancelled by user")
+
+// ErrTakenOver задачу сочли брошенной, вернули в очередь и забрал другой воркер: результат этого
+// воркера не сохраняется
+var ErrTakenOver = errors.New("job was taken over by another worker")
+
+// Handler выполняет задачу. Статусы этапов обновляются через Queue.SetStatus.
+type Handler func(ctx context.Context, job *model.Job) error
+
+// FinishHook вызывается после того, как задача окончательно завершилась (done, failed или cancelled)
+type FinishHook func(job *model.Job)
+
+// Queue персистентная очередь задач поверх storage.JobRepository с пулом воркеров.
+// Задачи переживают перезапуск: незавершенные задачи возвращаются в очередь и выполняются заново.
+type Queue struct {
+	repo     storage.JobRepository
+	handler  Handler
+	onFinish FinishHook
+	workers  int
+	notify   chan struct{}
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[int64]context.CancelCauseFunc
+}
+
+func New(repo storage.JobRepository, workers int, handler Handler) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Queue{
+		repo:    repo,
+		handler: handler,
+		workers: workers,
+		notify:  make(chan struct{}, 1),
+		running: make(map[int64]context.CancelCauseFunc),
+	}
+}
+
+// OnFinish задает обработчик завершения задач; вызывается до Start
+func (q *Queue) OnFinish(hook FinishHook) {
+	q.onFinish = hook
+}
+
+func (q *Queue) finished(job *model.Job) {
+	if q.onFinish != nil {
+		q.onFinish(job)
+	}
+}
+
+// Enqueue сохраняет задачу в статусе queued и будит свободного воркера
+func (q *Queue) Enqueue(job *model.Job) error {
+	job.Status = model.JobStatusQueued
+	if err := q.repo.CreateJob(job); err != nil {
+		return err
+	}
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// SetStatus сохраняет новый статус задачи; ErrTakenOver - задачу уже выполняет другой воркер
+func (q *Queue) SetStatus(job *model.Job, status string) error {
+	job.Status = status
+	ok, err := q.repo.UpdateJob(job)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrTakenOver
+	}
+	return nil
+}
+
+// Cancel отменяет задачу. Задача из очереди сразу получает статус cancelled; у выполняющейся
+// выставляется флаг отмены, и ее контекст отменяется с причиной ErrCancelled.
+// Возвращает актуальное состояние задачи и false, если задача уже завершена.
+func (q *Queue) Cancel(jobID int64) (*model.Job, bool, error) {
+	cancelled, err := q.repo.CancelQueuedJob(jobID)
+	if err != nil {
+		return nil, false, err
+	}
+	job, err := q.repo.GetJob(jobID)
+	if err != nil {
+		return nil, false, err
+	}
+	if cancelled {
+		q.finished(job)
+		return job, true, nil
+	}
+	if !slices.Contains(model.JobActiveStatuses, job.Status) {
+		return job, false, nil
+	}
+
+	if err := q.repo.RequestJobCancel(jobID); err != nil {
+		return nil, false, err
+	}
+	job.CancelRequested = true
+	q.cancelRunning(jobID)
+	return job, true, nil
+}
+
+func (q *Queue) cancelRunning(jobID int64) {
+	q.mu.Lock()
+	cancel, ok := q.running[jobID]
+	q.mu.Unlock()
+	if ok {
+		cancel(ErrCancelled)
+	}
+}
+
+// Start возвращает в очередь брошенные задачи и запускает воркеры.
+// После отмены acceptCtx воркеры не берут новые задачи; jobsCtx передается в Handler
+// и отменяется, когда выполняющиеся задачи нужно прервать.
+func (q *Queue) Start(acceptCtx, jobsCtx context.Context) {
+	q.recoverStale(true)
+
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.worker(acceptCtx, jobsCtx)
+	}
+
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		ticker := time.NewTicker(staleAfter)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-acceptCtx.Done():
+				return
+			case <-ticker.C:
+				q.recoverStale(false)
+			}
+		}
+	}()
+}
+
+// Wait ждет, пока все воркеры завершатся после отмены acceptCtx
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+// recoverStale возвращает в очередь задачи, воркеры которых перестали обновлять heartbeat.
+// При старте процесса (onStartup) это задачи, прерванные аварийным завершением предыдущего запуска.
+func (q *Queue) recoverStale(onStartup bool) {
+	n, err := q.repo.RequeueStaleJobs(model.JobActiveStatuses, time.Now().Add(-staleAfter))
+	if err != nil {
+		log.Printf("Queue: error requeueing stale jobs: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Queue: requeued %d stale jobs (startup: %v)", n, onStartup)
+	}
+}
+
+func (q *Queue) worker(acceptCtx, jobsCtx context.Context) {
+	defer q.wg.Done()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if acceptCtx.Err() != nil {
+			return
+		}
+
+		job, err := q.repo.ClaimNextJob(model.JobStatusDownloading)
+		if err == nil {
+			q.run(jobsCtx, job)
+			continue
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Queue: error claiming job: %v", err)
+		}
+
+		select {
+		case <-acceptCtx.Done():
+			return
+		case <-q.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *Queue) run(ctx context.Context, job *model.Job) {
+	if job.CancelRequested {
+		// Отмену запросили, пока задача ждала повторного запуска
+		log.Printf("Queue: job %d was cancelled before restart", job.ID)
+		job.Status = model.JobStatusCancelled
+		if q.save(job) {
+			q.finished(job)
+		}
+		return
+	}
+	log.Printf("Queue: starting job %d (%s %s)", job.ID, job.Kind, job.Source)
+
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	q.mu.Lock()
+	q.running[job.ID] = cancel
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, job.ID)
+		q.mu.Unlock()
+	}()
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.Background())
+	defer stopHeartbeat()
+	go q.heartbeat(heartbeatCtx, job.ID, job.Attempt, cancel)
+
+	err := q.handler(jobCtx, job)
+	stopHeartbeat()
+	switch {
+	case err == nil:
+		job.Status = model.JobStatusDone
+		job.Error = ""
+	case errors.Is(context.Cause(jobCtx), ErrTakenOver):
+		log.Printf("Queue: job %d was taken over by another worker, dropping this run", job.ID)
+		return
+	case errors.Is(context.Cause(jobCtx), ErrCancelled):
+		log.Printf("Queue: job %d cancelled by user", job.ID)
+		job.Status = model.JobStatusCancelled
+		job.Error = ""
+	case ctx.Err() != nil:
+		// Прервано остановкой бота: после перезапуска задача выполнится заново
+		log.Printf("Queue: job %d interrupted by shutdown, returning it to the queue", job.ID)
+		job.Status = model.JobStatusQueued
+	default:
+		log.Printf("Queue: job %d failed: %v", job.ID, err)
+		job.Status = model.JobStatusFailed
+		job.Error = err.Error()
+	}
+	if q.save(job) && job.Status != model.JobStatusQueued {
+		q.finished(job)
+	}
+}
+
+// save сохраняет итог выполнения задачи. false - итог не сохранен: задачу вернули в очередь
+// (например, воркер пропустил heartbeat) и ее выполняет другой воркер, либо хранилище недоступно
+func (q *Queue) save(job *model.Job) bool {
+	ok, err := q.repo.UpdateJob(job)
+	if err != nil {
+		log.Printf("Queue: error saving job %d result: %v", job.ID, err)
+		return false
+	}
+	if !ok {
+		log.Printf("Queue: job %d was taken over by another worker, result of this run is dropped", job.ID)
+	}
+	return ok
+}
+
+// heartbeat обновляет время задачи, чтобы ее не сочли брошенной, и следит за флагом отмены.
+// Если задачу вернули в очередь или забрал другой воркер, выполнение прерывается с причиной ErrTakenOver.
+func (q *Queue) heartbeat(ctx context.Context, jobID int64, attempt int, cancel context.CancelCauseFunc) {
+	touch := time.NewTicker(heartbeatInterval)
+	defer touch.Stop()
+	check := time.NewTicker(cancelCheckInterval)
+	defer check.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-touch.C:
+			if err := q.repo.TouchJob(jobID, attempt); err != nil {
+				log.Printf("Queue: %v", err)
+			}
+		case <-check.C:
+			job, err := q.repo.GetJob(jobID)
+			if err != nil {
+				log.Printf("Queue: error checking job %d: %v", jobID, err)
+				continue
+			}
+			if job.Attempt != attempt || !slices.Contains(model.JobActiveStatuses, job.Status) {
+				cancel(ErrTakenOver)
+				return
+			}
+			if job.CancelRequested {
+				cancel(ErrCancelled)
+			}
+		}
+	}
+}
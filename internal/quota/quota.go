@@ -0,0 +1,137 @@
+package quota
+
+import (
+	"errors"
+	"main/internal/model"
+	"main/internal/storage"
+	"sync"
+	"time"
+)
+
+// Status состояние квоты в текущем окне: секунды аудио за сутки или число запросов за час
+type Status struct {
+	Used    float64
+	Limit   float64 // 0 - без ограничения
+	ResetAt time.Time
+}
+
+func (s Status) Unlimited() bool {
+	return s.Limit <= 0
+}
+
+// Remaining остаток квоты; для квоты без ограничения не имеет смысла
+func (s Status) Remaining() float64 {
+	return max(s.Limit-s.Used, 0)
+}
+
+// Allows проверяет, помещается ли amount в остаток квоты
+func (s Status) Allows(amount float64) bool {
+	return s.Unlimited() || s.Used+amount <= s.Limit
+}
+
+// Limiter считает расход квот по фиксированным окнам: аудио - за календарные сутки, запросы - за текущий час
+// (по локальному времени сервера). Лимиты по умолчанию заменяются индивидуальными, если они назначены.
+type Limiter struct {
+	repo storage.QuotaRepository
+
+	mu       sync.RWMutex
+	defaults model.QuotaLimits
+}
+
+func New(repo storage.QuotaRepository, defaults model.QuotaLimits) *Limiter {
+	return &Limiter{repo: repo, defaults: defaults}
+}
+
+// SetDefaults меняет лимиты по умолчанию (при перечитывании конфигурации)
+func (l *Limiter) SetDefaults(defaults model.QuotaLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.defaults = defaults
+}
+
+// Limits возвращает действующие лимиты пользователя и признак того, что они назначены индивидуально
+func (l *Limiter) Limits(userID int64) (model.QuotaLimits, bool, error) {
+	l.mu.RLock()
+	defaults := l.defaults
+	l.mu.RUnlock()
+
+	limits, err := l.repo.GetQuotaLimits(userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return defaults, false, nil
+	}
+	if err != nil {
+		return defaults, false, err
+	}
+	return limits, true, nil
+}
+
+// Audio квота на распознавание аудио за сутки, в секундах
+func (l *Limiter) Audio(userID int64, limits model.QuotaLimits) (Status, error) {
+	start := windowStart(model.QuotaUsageAudioSeconds, time.Now())
+	used, err := l.repo.GetUsage(userID, model.QuotaUsageAudioSeconds, start)
+	return Status{
+		Used:    used,
+		Limit:   float64(limits.AudioMinutesPerDay) * 60,
+		ResetAt: start.AddDate(0, 0, 1),
+	}, err
+}
+
+// Summaries квота на обработку ссылок за час
+func (l *Limiter) Summaries(userID int64, limits model.QuotaLimits) (Status, error) {
+	start := windowStart(model.QuotaUsageSummary, time.Now())
+	used, err := l.repo.GetUsage(userID, model.QuotaUsageSummary, start)
+	return Status{
+		Used:    used,
+		Limit:   float64(limits.SummariesPerHour),
+		ResetAt: start.Add(time.Hour),
+	}, err
+}
+
+// Record записывает расход квоты
+func (l *Limiter) Record(userID int64, kind string, amount float64) error {
+	if amount <= 0 {
+		return nil
+	}
+	return l.repo.AddUsage(userID, kind, windowStart(kind, time.Now()), amount)
+}
+
+// Reserve списывает amount, только если расход в текущем окне не превысит limit (0 - без ограничения,
+// расход все равно учитывается). Проверка и списание атомарны, поэтому квоту не превысят ни
+// параллельные запросы, ни несколько реплик бота.
+func (l *Limiter) Reserve(userID int64, kind string, amount, limit float64) (bool, error) {
+	window := windowStart(kind, time.Now())
+	if limit <= 0 {
+		return true, l.repo.AddUsage(userID, kind, window, amount)
+	}
+	return l.repo.ReserveUsage(userID, kind, window, amount, limit)
+}
+
+// Release возвращает расход, списанный в момент at, например за задачу, которая не выполнилась
+func (l *Limiter) Release(userID int64, kind string, at time.Time, amount float64) error {
+	return l.repo.ReleaseUsage(userID, kind, windowStart(kind, at), amount)
+}
+
+// Prune удаляет записи о расходе, которые уже не попадают ни в одно окно
+func (l *Limiter) Prune() (int64, error) {
+	return l.repo.DeleteUsageBefore(dayStart(time.Now()).AddDate(0, 0, -1))
+}
+
+// windowStart начало окна квоты вида kind, в которое попадает t: час для ссылок, сутки для аудио
+func windowStart(kind string, t time.Time) time.Time {
+	if kind == model.QuotaUsageSummary {
+		return hourStart(t)
+	}
+	return dayStart(t)
+}
+
+func dayStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// hourStart начало часа по местному времени: Truncate(time.Hour) отсчитывает часы от UTC и ошибается
+// в часовых поясах со смещением на полчаса
+func hourStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, t.Hour(), 0, 0, 0, t.Location())
+}
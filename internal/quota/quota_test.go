@@ -0,0 +1,196 @@
+package quota
+
+import (
+	"main/internal/model"
+	"main/internal/storage"
+	"testing"
+	"time"
+)
+
+func TestWindowStart(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*3600)
+	kolkata := time.FixedZone("IST", 5*3600+1800)
+	tests := []struct {
+		kind string
+		t    time.Time
+		want time.Time
+	}{
+		{model.QuotaUsageSummary, time.Date(2024, 3, 10, 14, 59, 59, 0, moscow), time.Date(2024, 3, 10, 14, 0, 0, 0, moscow)},
+		{model.QuotaUsageSummary, time.Date(2024, 3, 10, 14, 0, 0, 0, moscow), time.Date(2024, 3, 10, 14, 0, 0, 0, moscow)},
+		// Полчаса смещения: Truncate(time.Hour) дал бы 14:30
+		{model.QuotaUsageSummary, time.Date(2024, 3, 10, 15, 10, 0, 0, kolkata), time.Date(2024, 3, 10, 15, 0, 0, 0, kolkata)},
+		{model.QuotaUsageAudioSeconds, time.Date(2024, 3, 10, 23, 59, 0, 0, moscow), time.Date(2024, 3, 10, 0, 0, 0, 0, moscow)},
+		{model.QuotaUsageAudioSeconds, time.Date(2024, 12, 31, 0, 30, 0, 0, kolkata), time.Date(2024, 12, 31, 0, 0, 0, 0, kolkata)},
+	}
+	for _, tt := range tests {
+		if got := windowStart(tt.kind, tt.t); !got.Equal(tt.want) {
+			t.Errorf("windowStart(%s, %v) = %v, want %v", tt.kind, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		status    Status
+		amount    float64
+		allows    bool
+		remaining float64
+	}{
+		{Status{Used: 0, Limit: 0}, 1000, true, 0},
+		{Status{Used: 3, Limit: 5}, 2, true, 2},
+		{Status{Used: 3, Limit: 5}, 3, false, 2},
+		{Status{Used: 5, Limit: 5}, 1, false, 0},
+		{Status{Used: 7, Limit: 5}, 0, false, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.status.Allows(tt.amount); got != tt.allows {
+			t.Errorf("%+v.Allows(%v) = %v, want %v", tt.status, tt.amount, got, tt.allows)
+		}
+		if !tt.status.Unlimited() {
+			if got := tt.status.Remaining(); got != tt.remaining {
+				t.Errorf("%+v.Remaining() = %v, want %v", tt.status, got, tt.remaining)
+			}
+		}
+	}
+}
+
+// memoryRepo QuotaRepository в памяти
+type memoryRepo struct {
+	usage  map[usageKey]float64
+	limits map[int64]model.QuotaLimits
+}
+
+type usageKey struct {
+	userID int64
+	kind   string
+	window int64
+}
+
+func newMemoryRepo() *memoryRepo {
+	return &memoryRepo{usage: make(map[usageKey]float64), limits: make(map[int64]model.QuotaLimits)}
+}
+
+func (r *memoryRepo) AddUsage(userID int64, kind string, window time.Time, amount float64) error {
+	r.usage[usageKey{userID, kind, window.Unix()}] += amount
+	return nil
+}
+
+func (r *memoryRepo) ReserveUsage(userID int64, kind string, window time.Time, amount, limit float64) (bool, error) {
+	key := usageKey{userID, kind, window.Unix()}
+	if r.usage[key]+amount > limit {
+		return false, nil
+	}
+	r.usage[key] += amount
+	return true, nil
+}
+
+func (r *memoryRepo) ReleaseUsage(userID int64, kind string, window time.Time, amount float64) error {
+	key := usageKey{userID, kind, window.Unix()}
+	r.usage[key] = max(r.usage[key]-amount, 0)
+	return nil
+}
+
+func (r *memoryRepo) GetUsage(userID int64, kind string, window time.Time) (float64, error) {
+	return r.usage[usageKey{userID, kind, window.Unix()}], nil
+}
+
+func (r *memoryRepo) GetQuotaLimits(userID int64) (model.QuotaLimits, error) {
+	limits, ok := r.limits[userID]
+	if !ok {
+		return model.QuotaLimits{}, storage.ErrNotFound
+	}
+	return limits, nil
+}
+
+func (r *memoryRepo) SetQuotaLimits(userID int64, limits model.QuotaLimits) error {
+	r.limits[userID] = limits
+	return nil
+}
+
+func (r *memoryRepo) DeleteQuotaLimits(userID int64) error {
+	delete(r.limits, userID)
+	return nil
+}
+
+func (r *memoryRepo) DeleteUsageBefore(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestLimiterReserve(t *testing.T) {
+	limiter := New(newMemoryRepo(), model.QuotaLimits{SummariesPerHour: 2})
+	const userID = 1
+
+	for i, want := range []bool{true, true, false} {
+		ok, err := limiter.Reserve(userID, model.QuotaUsageSummary, 1, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != want {
+			t.Errorf("Reserve #%d = %v, want %v", i+1, ok, want)
+		}
+	}
+
+	limits, _, err := limiter.Limits(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := limiter.Summaries(userID, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Used != 2 || status.Allows(1) {
+		t.Errorf("Summaries() = %+v, want 2 used and no room left", status)
+	}
+	if want := hourStart(time.Now()).Add(time.Hour); !status.ResetAt.Equal(want) {
+		t.Errorf("ResetAt = %v, want %v", status.ResetAt, want)
+	}
+
+	if err := limiter.Release(userID, model.QuotaUsageSummary, time.Now(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := limiter.Reserve(userID, model.QuotaUsageSummary, 1, 2); !ok {
+		t.Error("Reserve after Release = false, want true")
+	}
+
+	// Без ограничения расход учитывается, но не проверяется
+	for range 5 {
+		if ok, _ := limiter.Reserve(2, model.QuotaUsageSummary, 1, 0); !ok {
+			t.Fatal("Reserve without limit = false")
+		}
+	}
+	if status, _ := limiter.Summaries(2, model.QuotaLimits{}); status.Used != 5 {
+		t.Errorf("Summaries().Used without limit = %v, want 5", status.Used)
+	}
+}
+
+func TestLimiterLimits(t *testing.T) {
+	repo := newMemoryRepo()
+	defaults := model.QuotaLimits{AudioMinutesPerDay: 60, SummariesPerHour: 10}
+	limiter := New(repo, defaults)
+
+	if limits, custom, err := limiter.Limits(1); err != nil || custom || limits != defaults {
+		t.Errorf("Limits() = %+v, %v, %v, want defaults", limits, custom, err)
+	}
+	personal := model.QuotaLimits{AudioMinutesPerDay: 5}
+	repo.SetQuotaLimits(1, personal)
+	if limits, custom, err := limiter.Limits(1); err != nil || !custom || limits != personal {
+		t.Errorf("Limits() = %+v, %v, %v, want personal limits", limits, custom, err)
+	}
+
+	updated := model.QuotaLimits{SummariesPerHour: 3}
+	limiter.SetDefaults(updated)
+	if limits, _, _ := limiter.Limits(2); limits != updated {
+		t.Errorf("Limits() after SetDefaults = %+v, want %+v", limits, updated)
+	}
+
+	status, err := limiter.Audio(1, personal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Limit != 300 {
+		t.Errorf("Audio().Limit = %v, want 300 seconds", status.Limit)
+	}
+	if want := dayStart(time.Now()).AddDate(0, 0, 1); !status.ResetAt.Equal(want) {
+		t.Errorf("Audio().ResetAt = %v, want %v", status.ResetAt, want)
+	}
+}
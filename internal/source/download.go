@@ -0,0 +1,149 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrTooLarge файл по прямой ссылке больше разрешенного размера
+var ErrTooLarge = errors.New("file is too large")
+
+// Сети, в которые не ходит клиент для прямых ссылок: локальные, частные, служебные и зарезервированные
+// диапазоны (IANA special-purpose registry). Хост из allowlist мог бы указывать на внутреннюю сеть.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // CGNAT
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.88.99.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"), // сети для тестирования производительности
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/23"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"), // 6to4 может вести на частный IPv4-адрес
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// Не больше стольких перенаправлений при скачивании (как у http.Client по умолчанию)
+const maxRedirects = 10
+
+var directClient = &http.Client{
+	Timeout: 30 * time.Minute,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 30 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				addrPort, err := netip.ParseAddrPort(address)
+				if err != nil {
+					return err
+				}
+				if blockedAddr(addrPort.Addr()) {
+					return fmt.Errorf("connection to %s is not allowed", address)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   15 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	},
+}
+
+// blockedAddr проверяет, что адрес не глобальный; IPv4-адреса в виде ::ffff:a.b.c.d проверяются как IPv4
+func blockedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Download скачивает файл по прямой ссылке в localPath, проверяя, что это аудио или видео
+// и что размер не превышает maxBytes (0 - без ограничения). Перенаправления допускаются только
+// на разрешенные хосты.
+func (r *Registry) Download(ctx context.Context, rawURL string, localPath string, maxBytes int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %w", rawURL, err)
+	}
+	client := *directClient
+	client.CheckRedirect = r.checkRedirect
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad status downloading %s: %s", rawURL, resp.Status)
+	}
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if contentType != "" && contentType != "application/octet-stream" &&
+		!strings.HasPrefix(contentType, "audio/") && !strings.HasPrefix(contentType, "video/") {
+		return fmt.Errorf("unexpected content type %q for %s", contentType, rawURL)
+	}
+	if maxBytes > 0 && resp.ContentLength > maxBytes {
+		return fmt.Errorf("%w: %d bytes", ErrTooLarge, resp.ContentLength)
+	}
+
+	out, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("os.Create failed for %s: %w", localPath, err)
+	}
+	defer out.Close()
+
+	var body io.Reader = resp.Body
+	if maxBytes > 0 {
+		// Content-Length может отсутствовать или быть неверным: читаем на байт больше лимита
+		body = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	written, err := io.Copy(out, body)
+	if err != nil {
+		return fmt.Errorf("failed to save %s: %w", rawURL, err)
+	}
+	if maxBytes > 0 && written > maxBytes {
+		return fmt.Errorf("%w: more than %d bytes", ErrTooLarge, maxBytes)
+	}
+	log.Printf("Downloaded %s to %s (%d bytes, %s)", rawURL, localPath, written, contentType)
+	return nil
+}
+
+// checkRedirect пропускает перенаправление, только если новая ссылка проходит ту же проверку хоста, что и исходная
+func (r *Registry) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if _, ok := r.parse(req.URL.String()); !ok {
+		return fmt.Errorf("redirect to %s is not allowed", req.URL.Redacted())
+	}
+	return nil
+}
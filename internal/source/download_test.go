@@ -0,0 +1,66 @@
+package source
+
+import (
+	"net/http"
+	"net/netip"
+	"net/url"
+	"testing"
+)
+
+func TestBlockedAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		{"8.8.8.8", false},
+		{"2a00:1450:4010:c05::8a", false},
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.20.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"100.127.255.255", true},
+		{"100.128.0.1", false},
+		{"198.18.0.1", true},
+		{"198.19.255.255", true},
+		{"0.0.0.0", true},
+		{"224.0.0.1", true},
+		{"::1", true},
+		{"::ffff:10.0.0.1", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"2002:a00:1::1", true},
+	}
+	for _, tt := range tests {
+		if got := blockedAddr(netip.MustParseAddr(tt.addr)); got != tt.blocked {
+			t.Errorf("blockedAddr(%s) = %v, want %v", tt.addr, got, tt.blocked)
+		}
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	registry := NewRegistry(Builtin(), []string{"example.com"})
+	request := func(rawURL string) *http.Request {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &http.Request{URL: u}
+	}
+	via := []*http.Request{request("https://example.com/file.mp3")}
+
+	if err := registry.checkRedirect(request("https://cdn.example.com/file.mp3"), via); err != nil {
+		t.Errorf("redirect to allowed host: %v", err)
+	}
+	if err := registry.checkRedirect(request("https://evil.com/file.mp3"), via); err == nil {
+		t.Error("redirect to foreign host allowed")
+	}
+	many := make([]*http.Request, maxRedirects)
+	for i := range many {
+		many[i] = via[0]
+	}
+	if err := registry.checkRedirect(request("https://example.com/file.mp3"), many); err == nil {
+		t.Error("redirect chain longer than maxRedirects allowed")
+	}
+}
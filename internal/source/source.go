@@ -0,0 +1,307 @@
+package source
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Source площадка, с которой бот умеет брать аудио по ссылке
+type Source struct {
+	Name  string
+	Title string   // название для сообщений пользователю
+	Hosts []string // домены площадки; поддомены тоже подходят
+	// Validate проверяет, что ссылка ведет на отдельное видео или выпуск, а не на канал или главную страницу
+	Validate func(u *url.URL) bool
+	// ID извлекает идентификатор видео на площадке; пустая строка - не удалось
+	ID func(u *url.URL) string
+	// Playlist распознает ссылку на плейлист или канал и возвращает ссылку, по которой yt-dlp перечислит видео
+	Playlist func(u *url.URL) (string, bool)
+	// YtdlpArgs дополнительные аргументы yt-dlp для площадки
+	YtdlpArgs []string
+	// Direct - файл скачивается напрямую по HTTP, без yt-dlp
+	Direct bool
+	// Subtitles - у площадки есть субтитры, которые стоит попробовать до распознавания речи
+	Subtitles bool
+	// Cookies - передавать yt-dlp файл cookies (YOUTUBE_COOKIES_PATH)
+	Cookies bool
+}
+
+var (
+	youtubeIDRe   = regexp.MustCompile(`^[\w-]{11}$`)
+	youtubePathRe = regexp.MustCompile(`^/(shorts|live)/([\w-]{11})/?$`)
+	vkVideoRe     = regexp.MustCompile(`(video|clip)(-?\d+_\d+)`)
+	rutubeRe      = regexp.MustCompile(`^/(video|shorts|play/embed)/([0-9a-f]{32})/?$`)
+	vimeoRe       = regexp.MustCompile(`^/(video/)?(\d+)(/[0-9a-f]+)?/?$`)
+	soundcloudRe  = regexp.MustCompile(`^/[\w-]+/[\w-]+/?$`)
+
+	youtubeChannelRe = regexp.MustCompile(`^/(@[\w.-]+|channel/[\w-]+|c/[\w.-]+|user/[\w.-]+)(/(videos|streams|shorts))?/?$`)
+	rutubePlaylistRe = regexp.MustCompile(`^/plst/\d+/?$`)
+	vimeoPlaylistRe  = regexp.MustCompile(`^/(showcase|album|channels)/[\w-]+/?$`)
+	soundcloudSetRe  = regexp.MustCompile(`^/[\w-]+/sets/[\w-]+/?$`)
+)
+
+// Расширения файлов, которые можно скачать напрямую
+var directExtensions = map[string]bool{
+	".mp3": true, ".m4a": true, ".aac": true, ".ogg": true, ".oga": true, ".opus": true,
+	".wav": true, ".flac": true, ".mp4": true, ".m4v": true, ".mov": true, ".webm": true, ".mkv": true,
+}
+
+// Builtin площадки, которые поддерживаются без настройки
+func Builtin() []*Source {
+	return []*Source{
+		{
+			Name:  "youtube",
+			Title: "YouTube",
+			Hosts: []string{"youtube.com", "youtu.be"},
+			Validate: func(u *url.URL) bool {
+				if hostMatches(u.Hostname(), "youtu.be") {
+					return youtubeIDRe.MatchString(strings.Trim(u.Path, "/"))
+				}
+				if u.Path == "/watch" {
+					return youtubeIDRe.MatchString(u.Query().Get("v"))
+				}
+				return youtubePathRe.MatchString(u.Path)
+			},
+			ID: func(u *url.URL) string {
+				if hostMatches(u.Hostname(), "youtu.be") {
+					return strings.Trim(u.Path, "/")
+				}
+				if u.Path == "/watch" {
+					return u.Query().Get("v")
+				}
+				return submatch(youtubePathRe, u.Path, 2)
+			},
+			Playlist: func(u *url.URL) (string, bool) {
+				if u.Path == "/playlist" && u.Query().Get("list") != "" {
+					return u.String(), true
+				}
+				m := youtubeChannelRe.FindStringSubmatch(u.Path)
+				if m == nil {
+					return "", false
+				}
+				// Без вкладки yt-dlp вернет вкладки канала, а не видео
+				if m[3] == "" {
+					return "https://www.youtube.com/" + m[1] + "/videos", true
+				}
+				return u.String(), true
+			},
+			Subtitles: true,
+			Cookies:   true,
+		},
+		{
+			Name:  "vk",
+			Title: "VK Видео",
+			Hosts: []string{"vk.com", "vk.ru", "vkvideo.ru"},
+			Validate: func(u *url.URL) bool {
+				return vkVideoRe.MatchString(u.Path) || vkVideoRe.MatchString(u.Query().Get("z"))
+			},
+			ID: func(u *url.URL) string {
+				if id := submatch(vkVideoRe, u.Path, 2); id != "" {
+					return id
+				}
+				return submatch(vkVideoRe, u.Query().Get("z"), 2)
+			},
+		},
+		{
+			Name:     "rutube",
+			Title:    "Rutube",
+			Hosts:    []string{"rutube.ru"},
+			Validate: func(u *url.URL) bool { return rutubeRe.MatchString(u.Path) },
+			ID:       func(u *url.URL) string { return submatch(rutubeRe, u.Path, 2) },
+			Playlist: func(u *url.URL) (string, bool) { return u.String(), rutubePlaylistRe.MatchString(u.Path) },
+		},
+		{
+			Name:      "vimeo",
+			Title:     "Vimeo",
+			Hosts:     []string{"vimeo.com"},
+			Validate:  func(u *url.URL) bool { return vimeoRe.MatchString(u.Path) },
+			ID:        func(u *url.URL) string { return submatch(vimeoRe, u.Path, 2) },
+			Playlist:  func(u *url.URL) (string, bool) { return u.String(), vimeoPlaylistRe.MatchString(u.Path) },
+			Subtitles: true,
+		},
+		{
+			Name:  "apple_podcasts",
+			Title: "Apple Podcasts",
+			Hosts: []string{"podcasts.apple.com"},
+			Validate: func(u *url.URL) bool {
+				// Ссылка на выпуск: /<страна>/podcast/<название>/id<число>?i=<id выпуска>
+				return strings.Contains(u.Path, "/podcast/") && u.Query().Get("i") != ""
+			},
+			ID: func(u *url.URL) string { return u.Query().Get("i") },
+		},
+		{
+			Name:     "soundcloud",
+			Title:    "SoundCloud",
+			Hosts:    []string{"soundcloud.com"},
+			Validate: func(u *url.URL) bool { return soundcloudRe.MatchString(u.Path) },
+			ID:       func(u *url.URL) string { return strings.ToLower(strings.Trim(u.Path, "/")) },
+			Playlist: func(u *url.URL) (string, bool) { return u.String(), soundcloudSetRe.MatchString(u.Path) },
+		},
+	}
+}
+
+// VideoID канонический идентификатор видео, например "youtube:dQw4w9WgXcQ": разные варианты
+// ссылки на одно видео (youtu.be, watch?v=, shorts) дают один идентификатор
+func (s *Source) VideoID(u *url.URL) string {
+	if s.ID != nil {
+		if id := s.ID(u); id != "" {
+			return s.Name + ":" + id
+		}
+	}
+	// Идентификатор не извлекается (например, прямая ссылка на файл) - берется хэш ссылки без фрагмента
+	normalized := *u
+	normalized.Fragment = ""
+	normalized.Host = strings.ToLower(normalized.Host)
+	sum := sha256.Sum256([]byte(normalized.String()))
+	return s.Name + ":" + hex.EncodeToString(sum[:16])
+}
+
+func submatch(re *regexp.Regexp, text string, group int) string {
+	m := re.FindStringSubmatch(text)
+	if len(m) <= group {
+		return ""
+	}
+	return m[group]
+}
+
+// direct прямые ссылки на аудио- и видеофайлы с разрешенных хостов
+var direct = &Source{
+	Name:   "direct",
+	Title:  "файл по ссылке",
+	Direct: true,
+	Validate: func(u *url.URL) bool {
+		return directExtensions[strings.ToLower(path.Ext(u.Path))]
+	},
+}
+
+// Registry выбирает площадку по ссылке. Ссылка принимается, только если ее хост есть в списке
+// разрешенных; прямые ссылки на файлы - с любого разрешенного хоста.
+type Registry struct {
+	sources []*Source
+	allowed []string
+	any     bool
+}
+
+// NewRegistry создает реестр. allowedHosts - разрешенные домены (с поддоменами), "*" разрешает любой хост;
+// пустой список разрешает домены встроенных площадок.
+func NewRegistry(sources []*Source, allowedHosts []string) *Registry {
+	r := &Registry{sources: sources}
+	for _, host := range allowedHosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		switch host {
+		case "":
+		case "*":
+			r.any = true
+		default:
+			r.allowed = append(r.allowed, strings.TrimPrefix(host, "."))
+		}
+	}
+	if len(allowedHosts) == 0 {
+		for _, source := range sources {
+			r.allowed = append(r.allowed, source.Hosts...)
+		}
+	}
+	return r
+}
+
+// Match находит площадку для ссылки; ok == false, если ссылка не поддерживается или хост не разрешен
+func (r *Registry) Match(rawURL string) (*Source, *url.URL, bool) {
+	u, ok := r.parse(rawURL)
+	if !ok {
+		return nil, nil, false
+	}
+	if source := r.sourceFor(u); source != nil {
+		if source.Validate == nil || source.Validate(u) {
+			return source, u, true
+		}
+		return nil, nil, false
+	}
+	if direct.Validate(u) {
+		return direct, u, true
+	}
+	return nil, nil, false
+}
+
+// MatchPlaylist распознает ссылку на плейлист или канал. Возвращает площадку и ссылку для перечисления видео.
+func (r *Registry) MatchPlaylist(rawURL string) (*Source, string, bool) {
+	u, ok := r.parse(rawURL)
+	if !ok {
+		return nil, "", false
+	}
+	source := r.sourceFor(u)
+	if source == nil || source.Playlist == nil {
+		return nil, "", false
+	}
+	playlistURL, ok := source.Playlist(u)
+	if !ok {
+		return nil, "", false
+	}
+	return source, playlistURL, true
+}
+
+// parse разбирает ссылку (схему можно не указывать) и проверяет, что ее хост разрешен
+func (r *Registry) parse(rawURL string) (*url.URL, bool) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" || strings.ContainsAny(rawURL, " \n\t") {
+		return nil, false
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return nil, false
+	}
+	if !r.hostAllowed(strings.ToLower(u.Hostname())) {
+		return nil, false
+	}
+	return u, true
+}
+
+func (r *Registry) sourceFor(u *url.URL) *Source {
+	host := strings.ToLower(u.Hostname())
+	for _, source := range r.sources {
+		for _, sourceHost := range source.Hosts {
+			if hostMatches(host, sourceHost) {
+				return source
+			}
+		}
+	}
+	return nil
+}
+
+// Titles названия поддерживаемых площадок для подсказок пользователю
+func (r *Registry) Titles() []string {
+	titles := make([]string, 0, len(r.sources))
+	for _, source := range r.sources {
+		for _, host := range source.Hosts {
+			if r.hostAllowed(host) {
+				titles = append(titles, source.Title)
+				break
+			}
+		}
+	}
+	return titles
+}
+
+func (r *Registry) hostAllowed(host string) bool {
+	if r.any {
+		return true
+	}
+	for _, allowed := range r.allowed {
+		if hostMatches(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostMatches сравнивает хост с доменом с учетом поддоменов (www.youtube.com подходит к youtube.com)
+func hostMatches(host, domain string) bool {
+	host = strings.ToLower(host)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
@@ -0,0 +1,107 @@
+package source
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TimeRange фрагмент видео в секундах; End == 0 - до конца видео
+type TimeRange struct {
+	Start float64
+	End   float64
+}
+
+// IsZero - диапазон не задан, обрабатывается все видео
+func (r TimeRange) IsZero() bool {
+	return r.Start <= 0 && r.End <= 0
+}
+
+// Contains проверяет, пересекается ли отрезок [start, end] с диапазоном
+func (r TimeRange) Contains(start, end float64) bool {
+	return end > r.Start && (r.End <= 0 || start < r.End)
+}
+
+// Длительность в формате YouTube: 90, 90s, 1m30s, 1h2m3s
+var unitTimestampRe = regexp.MustCompile(`^(?:(\d+)h)?(?:(\d+)m)?(?:(\d+(?:\.\d+)?)s?)?$`)
+
+// ParseTimestamp разбирает время "25:30", "1:02:03", "90", "1m30s" в секунды
+func ParseTimestamp(text string) (float64, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, fmt.Errorf("empty timestamp")
+	}
+	if strings.Contains(text, ":") {
+		parts := strings.Split(text, ":")
+		if len(parts) > 3 {
+			return 0, fmt.Errorf("invalid timestamp %q", text)
+		}
+		var seconds float64
+		for i, part := range parts {
+			value, err := strconv.ParseFloat(part, 64)
+			if err != nil || value < 0 || (i > 0 && value >= 60) {
+				return 0, fmt.Errorf("invalid timestamp %q", text)
+			}
+			seconds = seconds*60 + value
+		}
+		return seconds, nil
+	}
+
+	m := unitTimestampRe.FindStringSubmatch(strings.ToLower(text))
+	if m == nil {
+		return 0, fmt.Errorf("invalid timestamp %q", text)
+	}
+	var seconds float64
+	for i, multiplier := range []float64{3600, 60, 1} {
+		if m[i+1] == "" {
+			continue
+		}
+		value, _ := strconv.ParseFloat(m[i+1], 64)
+		seconds += value * multiplier
+	}
+	return seconds, nil
+}
+
+// ParseRange разбирает диапазон "10:00-25:30"; конец можно опустить ("10:00-" - до конца видео)
+func ParseRange(text string) (TimeRange, error) {
+	text = strings.ReplaceAll(strings.TrimSpace(text), "–", "-")
+	startText, endText, ok := strings.Cut(text, "-")
+	if !ok {
+		return TimeRange{}, fmt.Errorf("invalid range %q: expected start-end", text)
+	}
+	var r TimeRange
+	var err error
+	if r.Start, err = ParseTimestamp(startText); err != nil {
+		return TimeRange{}, err
+	}
+	if strings.TrimSpace(endText) != "" {
+		if r.End, err = ParseTimestamp(endText); err != nil {
+			return TimeRange{}, err
+		}
+		if r.End <= r.Start {
+			return TimeRange{}, fmt.Errorf("invalid range %q: end is before start", text)
+		}
+	}
+	return r, nil
+}
+
+// URLRange возвращает начало фрагмента из параметра ссылки t= (или start=, #t= у Vimeo)
+func URLRange(u *url.URL) TimeRange {
+	value := u.Query().Get("t")
+	if value == "" {
+		value = u.Query().Get("start")
+	}
+	if value == "" && strings.HasPrefix(u.Fragment, "t=") {
+		value = strings.TrimPrefix(u.Fragment, "t=")
+	}
+	if value == "" {
+		return TimeRange{}
+	}
+	start, err := ParseTimestamp(value)
+	if err != nil {
+		return TimeRange{}
+	}
+	return TimeRange{Start: start}
+}
@@ -0,0 +1,114 @@
+package source
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		text    string
+		seconds float64
+		wantErr bool
+	}{
+		{"90", 90, false},
+		{"90s", 90, false},
+		{"1m30s", 90, false},
+		{"1h2m3s", 3723, false},
+		{"2H", 7200, false},
+		{"1.5", 1.5, false},
+		{"25:30", 1530, false},
+		{"1:02:03", 3723, false},
+		{" 0:05 ", 5, false},
+		{"", 0, true},
+		{"1:60", 0, true},
+		{"1:2:3:4", 0, true},
+		{"-5", 0, true},
+		{"abc", 0, true},
+		{"10:xx", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimestamp(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTimestamp(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if got != tt.seconds {
+			t.Errorf("ParseTimestamp(%q) = %v, want %v", tt.text, got, tt.seconds)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    TimeRange
+		wantErr bool
+	}{
+		{"10:00-25:30", TimeRange{Start: 600, End: 1530}, false},
+		{"10:00 - 25:30", TimeRange{Start: 600, End: 1530}, false},
+		{"10:00–25:30", TimeRange{Start: 600, End: 1530}, false},
+		{"10:00-", TimeRange{Start: 600}, false},
+		{"1m-2m", TimeRange{Start: 60, End: 120}, false},
+		{"25:30-10:00", TimeRange{}, true},
+		{"10:00-10:00", TimeRange{}, true},
+		{"10:00", TimeRange{}, true},
+		{"-10:00", TimeRange{}, true},
+		{"10:00-abc", TimeRange{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRange(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRange(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRange(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestURLRange(t *testing.T) {
+	tests := []struct {
+		url  string
+		want TimeRange
+	}{
+		{"https://youtu.be/dQw4w9WgXcQ?t=42", TimeRange{Start: 42}},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=1m30s", TimeRange{Start: 90}},
+		{"https://www.youtube.com/embed/dQw4w9WgXcQ?start=15", TimeRange{Start: 15}},
+		{"https://vimeo.com/123456#t=2m", TimeRange{Start: 120}},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", TimeRange{}},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=bad", TimeRange{}},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := URLRange(u); got != tt.want {
+			t.Errorf("URLRange(%q) = %+v, want %+v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestTimeRangeContains(t *testing.T) {
+	r := TimeRange{Start: 60, End: 120}
+	tests := []struct {
+		start, end float64
+		want       bool
+	}{
+		{0, 30, false},
+		{30, 61, true},
+		{90, 100, true},
+		{119, 150, true},
+		{120, 150, false},
+	}
+	for _, tt := range tests {
+		if got := r.Contains(tt.start, tt.end); got != tt.want {
+			t.Errorf("Contains(%v, %v) = %v, want %v", tt.start, tt.end, got, tt.want)
+		}
+	}
+	if !(TimeRange{Start: 60}).Contains(1000, 1010) {
+		t.Error("open-ended range does not contain segment after start")
+	}
+}
@@ -0,0 +1,20 @@
+-- Пакетная обработка плейлистов: каждое видео - отдельная задача с batch_id
+CREATE TABLE batches (
+    id                  BIGSERIAL PRIMARY KEY,
+    user_id             BIGINT  NOT NULL,
+    chat_id             BIGINT  NOT NULL,
+    message_id          BIGINT  NOT NULL,
+    progress_message_id BIGINT  NOT NULL DEFAULT 0,
+    source              TEXT    NOT NULL,
+    title               TEXT    NOT NULL DEFAULT '',
+    entries             TEXT    NOT NULL DEFAULT '[]',
+    digest              INTEGER NOT NULL DEFAULT 0,
+    status              TEXT    NOT NULL,
+    created_at          BIGINT  NOT NULL,
+    updated_at          BIGINT  NOT NULL
+);
+
+ALTER TABLE jobs ADD COLUMN batch_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN result TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX jobs_batch_id_idx ON jobs (batch_id);
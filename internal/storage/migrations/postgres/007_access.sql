@@ -0,0 +1,17 @@
+-- Список доступа: пользователи и группы, которым разрешено пользоваться ботом
+CREATE TABLE allowlist (
+    subject_type TEXT   NOT NULL,
+    subject_id   BIGINT NOT NULL,
+    added_by     BIGINT NOT NULL DEFAULT 0,
+    created_at   BIGINT NOT NULL,
+    PRIMARY KEY (subject_type, subject_id)
+);
+
+CREATE TABLE invites (
+    code       TEXT   PRIMARY KEY,
+    created_by BIGINT NOT NULL,
+    created_at BIGINT NOT NULL,
+    expires_at BIGINT NOT NULL,
+    used_by    BIGINT NOT NULL DEFAULT 0,
+    used_at    BIGINT NOT NULL DEFAULT 0
+);
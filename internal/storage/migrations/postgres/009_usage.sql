@@ -0,0 +1,15 @@
+-- Учет расхода платных API: токены запросов к нейросети и секунды распознанного аудио
+CREATE TABLE usage_records (
+    id                BIGSERIAL PRIMARY KEY,
+    user_id           BIGINT  NOT NULL,
+    chat_id           BIGINT  NOT NULL,
+    kind              TEXT    NOT NULL,
+    model             TEXT    NOT NULL,
+    prompt_tokens     INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    audio_seconds     DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at        BIGINT  NOT NULL
+);
+
+CREATE INDEX usage_records_created_idx ON usage_records (created_at);
+CREATE INDEX usage_records_user_idx ON usage_records (user_id, created_at);
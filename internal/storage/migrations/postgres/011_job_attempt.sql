@@ -0,0 +1,3 @@
+-- Номер захвата задачи воркером: увеличивается при каждом ClaimNextJob. Воркер сохраняет результат,
+-- только если задачу после возврата в очередь не забрал другой воркер
+ALTER TABLE jobs ADD COLUMN attempt INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,44 @@
+CREATE TABLE users (
+    id         BIGINT PRIMARY KEY,
+    user_name  TEXT   NOT NULL DEFAULT '',
+    first_name TEXT   NOT NULL DEFAULT '',
+    last_name  TEXT   NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,
+    last_seen  BIGINT NOT NULL
+);
+
+CREATE TABLE user_settings (
+    user_id    BIGINT PRIMARY KEY,
+    data       TEXT   NOT NULL,
+    updated_at BIGINT NOT NULL
+);
+
+CREATE TABLE jobs (
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id             BIGINT NOT NULL,
+    chat_id             BIGINT NOT NULL,
+    message_id          BIGINT NOT NULL,
+    progress_message_id BIGINT NOT NULL DEFAULT 0,
+    kind                TEXT   NOT NULL,
+    source              TEXT   NOT NULL,
+    status              TEXT   NOT NULL,
+    error               TEXT   NOT NULL DEFAULT '',
+    created_at          BIGINT NOT NULL,
+    updated_at          BIGINT NOT NULL
+);
+
+CREATE INDEX jobs_status_idx ON jobs (status);
+
+CREATE TABLE transcripts (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id    BIGINT NOT NULL,
+    chat_id    BIGINT NOT NULL,
+    message_id BIGINT NOT NULL,
+    source     TEXT   NOT NULL DEFAULT '',
+    language   TEXT   NOT NULL DEFAULT '',
+    duration   REAL   NOT NULL DEFAULT 0,
+    text       TEXT   NOT NULL,
+    segments   TEXT   NOT NULL DEFAULT '[]',
+    created_at BIGINT NOT NULL,
+    UNIQUE (chat_id, message_id)
+);
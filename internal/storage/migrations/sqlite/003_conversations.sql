@@ -0,0 +1,15 @@
+-- Сообщения бота с результатами обработки: ответ на такое сообщение - вопрос по транскрипту source_message_id
+CREATE TABLE message_links (
+    chat_id           BIGINT NOT NULL,
+    message_id        BIGINT NOT NULL,
+    source_message_id BIGINT NOT NULL,
+    PRIMARY KEY (chat_id, message_id)
+);
+
+CREATE TABLE conversations (
+    chat_id           BIGINT NOT NULL,
+    source_message_id BIGINT NOT NULL,
+    messages          TEXT   NOT NULL DEFAULT '[]',
+    updated_at        BIGINT NOT NULL,
+    PRIMARY KEY (chat_id, source_message_id)
+);
@@ -0,0 +1,24 @@
+-- Кэш транскриптов и результатов по видео (ключ - канонический идентификатор видео)
+CREATE TABLE video_transcripts (
+    video_id   TEXT   NOT NULL,
+    language   TEXT   NOT NULL DEFAULT '',
+    source     TEXT   NOT NULL DEFAULT '',
+    metadata   TEXT   NOT NULL DEFAULT '{}',
+    text       TEXT   NOT NULL,
+    duration   REAL   NOT NULL DEFAULT 0,
+    segments   TEXT   NOT NULL DEFAULT '[]',
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (video_id, language)
+);
+
+CREATE TABLE video_summaries (
+    video_id   TEXT   NOT NULL,
+    language   TEXT   NOT NULL DEFAULT '',
+    variant    TEXT   NOT NULL,
+    summary    TEXT   NOT NULL,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (video_id, language, variant)
+);
+
+-- Задача с принудительным обновлением не берет результат из кэша
+ALTER TABLE jobs ADD COLUMN refresh INTEGER NOT NULL DEFAULT 0;
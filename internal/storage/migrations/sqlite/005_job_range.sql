@@ -0,0 +1,3 @@
+-- Фрагмент видео для обработки в секундах; 0 - с начала / до конца
+ALTER TABLE jobs ADD COLUMN range_start REAL NOT NULL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN range_end REAL NOT NULL DEFAULT 0;
@@ -0,0 +1,18 @@
+-- Расход квот пользователей: секунды распознанного аудио и запросы на обработку видео. Расход хранится
+-- счетчиком на окно (сутки или час), чтобы проверка остатка и списание выполнялись одним условным UPDATE
+CREATE TABLE quota_usage (
+    user_id      BIGINT NOT NULL,
+    kind         TEXT   NOT NULL,
+    window_start BIGINT NOT NULL,
+    amount       REAL   NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, kind, window_start)
+);
+
+-- Индивидуальные лимиты, назначенные администратором вместо лимитов из конфигурации
+CREATE TABLE quota_overrides (
+    user_id               BIGINT  PRIMARY KEY,
+    audio_minutes_per_day INTEGER NOT NULL DEFAULT 0,
+    summaries_per_hour    INTEGER NOT NULL DEFAULT 0,
+    max_duration_minutes  INTEGER NOT NULL DEFAULT 0,
+    updated_at            BIGINT  NOT NULL
+);
@@ -0,0 +1,7 @@
+-- Заблокированные администратором пользователи
+CREATE TABLE bans (
+    user_id    BIGINT PRIMARY KEY,
+    banned_by  BIGINT NOT NULL,
+    reason     TEXT   NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL
+);
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	coreconfig "main/tools/pkg/core_config"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	DialectSQLite   = "sqlite"
+	DialectPostgres = "postgres"
+
+	defaultSQLitePath = "./upload/bot.db"
+)
+
+// Open подключается к БД по настройкам coreconfig.Database и применяет миграции.
+// Postgres выбирается, если DB_URI начинается с postgres:// (postgresql://) или задан DB_HOST,
+// иначе используется встроенный SQLite: DB_URI вида sqlite://path/to/bot.db или просто путь к файлу.
+func Open(cfg coreconfig.Database) (*SQLStore, error) {
+	dialect, dsn := resolveDSN(cfg)
+
+	var db *sql.DB
+	var err error
+	switch dialect {
+	case DialectPostgres:
+		db, err = sql.Open("pgx", dsn)
+	default:
+		if dir := filepath.Dir(dsn); dir != "" {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return nil, fmt.Errorf("failed to create database dir %s: %w", dir, err)
+			}
+		}
+		db, err = sql.Open("sqlite", dsn+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", dialect, err)
+	}
+	if dialect == DialectSQLite {
+		// SQLite не поддерживает конкурентную запись, достаточно одного соединения
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to %s database: %w", dialect, err)
+	}
+
+	store := &SQLStore{db: db, dialect: dialect}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	log.Printf("INFO: Connected to %s database", dialect)
+	return store, nil
+}
+
+func resolveDSN(cfg coreconfig.Database) (string, string) {
+	uri := strings.TrimSpace(cfg.URI)
+	if strings.HasPrefix(uri, "postgres://") || strings.HasPrefix(uri, "postgresql://") {
+		return DialectPostgres, uri
+	}
+	if uri == "" && cfg.Host != "" {
+		host := cfg.Host
+		if cfg.Port != 0 {
+			host += ":" + strconv.Itoa(cfg.Port)
+		}
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(cfg.User, cfg.Password),
+			Host:     host,
+			Path:     "/" + cfg.Name,
+			RawQuery: "sslmode=disable",
+		}
+		return DialectPostgres, dsn.String()
+	}
+
+	path := strings.TrimPrefix(uri, "sqlite://")
+	if path == "" {
+		path = defaultSQLitePath
+	}
+	return DialectSQLite, path
+}
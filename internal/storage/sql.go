@@ -0,0 +1,882 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"main/internal/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLStore реализация Repository поверх database/sql для SQLite и Postgres.
+// Запросы пишутся с плейсхолдерами "?", для Postgres они заменяются на $1, $2, ...
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// DB возвращает соединение для пакетов, которым нужны собственные таблицы
+func (s *SQLStore) DB() *sql.DB {
+	return s.db
+}
+
+// Dialect возвращает DialectSQLite или DialectPostgres
+func (s *SQLStore) Dialect() string {
+	return s.dialect
+}
+
+func (s *SQLStore) rebind(query string) string {
+	if s.dialect != DialectPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *SQLStore) GetSettings(userID int64) (model.UserSettings, error) {
+	var settings model.UserSettings
+	var data string
+	err := s.db.QueryRow(s.rebind(`SELECT data FROM user_settings WHERE user_id = ?`), userID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, fmt.Errorf("failed to load settings for user %d: %w", userID, err)
+	}
+	if err := json.Unmarshal([]byte(data), &settings); err != nil {
+		return settings, fmt.Errorf("failed to parse settings for user %d: %w", userID, err)
+	}
+	return settings, nil
+}
+
+func (s *SQLStore) SaveSettings(userID int64, settings model.UserSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal settings: %w", err)
+	}
+	_, err = s.db.Exec(s.rebind(`INSERT INTO user_settings (user_id, data, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`),
+		userID, string(data), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save settings for user %d: %w", userID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) UpsertUser(user model.User) error {
+	now := time.Now().Unix()
+	_, err := s.db.Exec(s.rebind(`INSERT INTO users (id, user_name, first_name, last_name, created_at, last_seen) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET user_name = excluded.user_name, first_name = excluded.first_name,
+			last_name = excluded.last_name, last_seen = excluded.last_seen`),
+		user.ID, user.UserName, user.FirstName, user.LastName, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to upsert user %d: %w", user.ID, err)
+	}
+	return nil
+}
+
+const userColumns = `id, user_name, first_name, last_name, created_at, last_seen`
+
+func scanUser(row interface{ Scan(...any) error }) (*model.User, error) {
+	var user model.User
+	var createdAt, lastSeen int64
+	if err := row.Scan(&user.ID, &user.UserName, &user.FirstName, &user.LastName, &createdAt, &lastSeen); err != nil {
+		return nil, err
+	}
+	user.CreatedAt = time.Unix(createdAt, 0)
+	user.LastSeen = time.Unix(lastSeen, 0)
+	return &user, nil
+}
+
+func (s *SQLStore) GetUser(id int64) (*model.User, error) {
+	user, err := scanUser(s.db.QueryRow(s.rebind(`SELECT `+userColumns+` FROM users WHERE id = ?`), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user %d: %w", id, err)
+	}
+	return user, nil
+}
+
+func (s *SQLStore) ListUsers() ([]model.User, error) {
+	rows, err := s.db.Query(`SELECT ` + userColumns + ` FROM users ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+func (s *SQLStore) ListChatIDs() ([]int64, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT id FROM users
+		UNION SELECT chat_id FROM jobs
+		UNION SELECT subject_id FROM allowlist WHERE subject_type = ?`), model.AccessSubjectChat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chats: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan chat id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *SQLStore) CreateJob(job *model.Job) error {
+	now := time.Now()
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = now
+	}
+	job.UpdatedAt = now
+	err := s.db.QueryRow(s.rebind(`INSERT INTO jobs (user_id, chat_id, message_id, progress_message_id, kind, source, status, error,
+			refresh, range_start, range_end, batch_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+		job.UserID, job.ChatID, job.MessageID, job.ProgressMessageID, job.Kind, job.Source, job.Status, job.Error,
+		boolToInt(job.Refresh), job.RangeStart, job.RangeEnd, job.BatchID, job.CreatedAt.Unix(), now.Unix()).Scan(&job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create job: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) UpdateJob(job *model.Job) (bool, error) {
+	job.UpdatedAt = time.Now()
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(model.JobActiveStatuses)), ", ")
+	args := []any{job.ProgressMessageID, job.Status, job.Error, job.Result, job.UpdatedAt.Unix(), job.ID, job.Attempt}
+	for _, status := range model.JobActiveStatuses {
+		args = append(args, status)
+	}
+	result, err := s.db.Exec(s.rebind(`UPDATE jobs SET progress_message_id = ?, status = ?, error = ?, result = ?, updated_at = ?
+		WHERE id = ? AND attempt = ? AND status IN (`+placeholders+`)`), args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to update job %d: %w", job.ID, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update job %d: %w", job.ID, err)
+	}
+	return n == 1, nil
+}
+
+const jobColumns = `id, user_id, chat_id, message_id, progress_message_id, kind, source, status, error, cancel_requested, refresh, range_start, range_end, batch_id, result, attempt, created_at, updated_at`
+
+func scanJob(row interface{ Scan(...any) error }) (*model.Job, error) {
+	var job model.Job
+	var createdAt, updatedAt, cancelRequested, refresh int64
+	if err := row.Scan(&job.ID, &job.UserID, &job.ChatID, &job.MessageID, &job.ProgressMessageID,
+		&job.Kind, &job.Source, &job.Status, &job.Error, &cancelRequested, &refresh,
+		&job.RangeStart, &job.RangeEnd, &job.BatchID, &job.Result, &job.Attempt, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	job.CancelRequested = cancelRequested != 0
+	job.Refresh = refresh != 0
+	job.CreatedAt = time.Unix(createdAt, 0)
+	job.UpdatedAt = time.Unix(updatedAt, 0)
+	return &job, nil
+}
+
+func (s *SQLStore) GetJob(id int64) (*model.Job, error) {
+	job, err := scanJob(s.db.QueryRow(s.rebind(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load job %d: %w", id, err)
+	}
+	return job, nil
+}
+
+func (s *SQLStore) ListJobsByStatus(statuses ...string) ([]model.Job, error) {
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(statuses)), ", ")
+	args := make([]any, len(statuses))
+	for i, status := range statuses {
+		args[i] = status
+	}
+	return s.queryJobs(`SELECT `+jobColumns+` FROM jobs WHERE status IN (`+placeholders+`) ORDER BY id`, args...)
+}
+
+func (s *SQLStore) queryJobs(query string, args ...any) ([]model.Job, error) {
+	rows, err := s.db.Query(s.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []model.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+func (s *SQLStore) ClaimNextJob(status string) (*model.Job, error) {
+	// Несколько воркеров (и реплик) могут выбрать одну и ту же задачу, поэтому переводим ее
+	// условным UPDATE и повторяем, если задачу уже забрали
+	for {
+		var id int64
+		err := s.db.QueryRow(s.rebind(`SELECT id FROM jobs WHERE status = ? ORDER BY id LIMIT 1`), model.JobStatusQueued).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to select queued job: %w", err)
+		}
+
+		result, err := s.db.Exec(s.rebind(`UPDATE jobs SET status = ?, attempt = attempt + 1, updated_at = ? WHERE id = ? AND status = ?`),
+			status, time.Now().Unix(), id, model.JobStatusQueued)
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim job %d: %w", id, err)
+		}
+		claimed, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim job %d: %w", id, err)
+		}
+		if claimed == 1 {
+			return s.GetJob(id)
+		}
+	}
+}
+
+func (s *SQLStore) TouchJob(id int64, attempt int) error {
+	if _, err := s.db.Exec(s.rebind(`UPDATE jobs SET updated_at = ? WHERE id = ? AND attempt = ?`), time.Now().Unix(), id, attempt); err != nil {
+		return fmt.Errorf("failed to touch job %d: %w", id, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) CancelQueuedJob(id int64) (bool, error) {
+	result, err := s.db.Exec(s.rebind(`UPDATE jobs SET status = ?, updated_at = ? WHERE id = ? AND status = ?`),
+		model.JobStatusCancelled, time.Now().Unix(), id, model.JobStatusQueued)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel job %d: %w", id, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel job %d: %w", id, err)
+	}
+	return n == 1, nil
+}
+
+func (s *SQLStore) RequestJobCancel(id int64) error {
+	if _, err := s.db.Exec(s.rebind(`UPDATE jobs SET cancel_requested = 1 WHERE id = ?`), id); err != nil {
+		return fmt.Errorf("failed to request cancel for job %d: %w", id, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) RequeueStaleJobs(statuses []string, olderThan time.Time) (int64, error) {
+	if len(statuses) == 0 {
+		return 0, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(statuses)), ", ")
+	args := []any{model.JobStatusQueued, time.Now().Unix()}
+	for _, status := range statuses {
+		args = append(args, status)
+	}
+	args = append(args, olderThan.Unix())
+
+	result, err := s.db.Exec(s.rebind(`UPDATE jobs SET status = ?, updated_at = ?
+		WHERE status IN (`+placeholders+`) AND updated_at < ?`), args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue stale jobs: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (s *SQLStore) CountJobsByStatus(since time.Time) (map[string]int, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT status, COUNT(*) FROM jobs WHERE created_at >= ? GROUP BY status`), since.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to count jobs: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan job count: %w", err)
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+func (s *SQLStore) SaveTranscript(transcript *model.StoredTranscript) error {
+	segments, err := json.Marshal(transcript.Segments)
+	if err != nil {
+		return fmt.Errorf("failed to marshal transcript segments: %w", err)
+	}
+	if transcript.CreatedAt.IsZero() {
+		transcript.CreatedAt = time.Now()
+	}
+	err = s.db.QueryRow(s.rebind(`INSERT INTO transcripts (user_id, chat_id, message_id, source, language, duration, text, segments, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat_id, message_id) DO UPDATE SET user_id = excluded.user_id, source = excluded.source,
+			language = excluded.language, duration = excluded.duration, text = excluded.text,
+			segments = excluded.segments, created_at = excluded.created_at
+		RETURNING id`),
+		transcript.UserID, transcript.ChatID, transcript.MessageID, transcript.Source, transcript.Language,
+		transcript.Duration, transcript.Text, string(segments), transcript.CreatedAt.Unix()).Scan(&transcript.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save transcript for message %d in chat %d: %w", transcript.MessageID, transcript.ChatID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetTranscript(chatID int64, messageID int) (*model.StoredTranscript, error) {
+	var transcript model.StoredTranscript
+	var segments string
+	var createdAt int64
+	err := s.db.QueryRow(s.rebind(`SELECT id, user_id, chat_id, message_id, source, language, duration, text, segments, created_at
+		FROM transcripts WHERE chat_id = ? AND message_id = ?`), chatID, messageID).Scan(
+		&transcript.ID, &transcript.UserID, &transcript.ChatID, &transcript.MessageID, &transcript.Source,
+		&transcript.Language, &transcript.Duration, &transcript.Text, &segments, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load transcript for message %d in chat %d: %w", messageID, chatID, err)
+	}
+	if err := json.Unmarshal([]byte(segments), &transcript.Segments); err != nil {
+		return nil, fmt.Errorf("failed to parse transcript segments: %w", err)
+	}
+	transcript.CreatedAt = time.Unix(createdAt, 0)
+	return &transcript, nil
+}
+
+func (s *SQLStore) LinkMessage(chatID int64, messageID, sourceMessageID int) error {
+	_, err := s.db.Exec(s.rebind(`INSERT INTO message_links (chat_id, message_id, source_message_id) VALUES (?, ?, ?)
+		ON CONFLICT (chat_id, message_id) DO UPDATE SET source_message_id = excluded.source_message_id`),
+		chatID, messageID, sourceMessageID)
+	if err != nil {
+		return fmt.Errorf("failed to link message %d in chat %d: %w", messageID, chatID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetLinkedSource(chatID int64, messageID int) (int, error) {
+	var sourceMessageID int
+	err := s.db.QueryRow(s.rebind(`SELECT source_message_id FROM message_links WHERE chat_id = ? AND message_id = ?`),
+		chatID, messageID).Scan(&sourceMessageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load link for message %d in chat %d: %w", messageID, chatID, err)
+	}
+	return sourceMessageID, nil
+}
+
+func (s *SQLStore) GetConversation(chatID int64, sourceMessageID int) ([]model.ChatMessage, error) {
+	var data string
+	err := s.db.QueryRow(s.rebind(`SELECT messages FROM conversations WHERE chat_id = ? AND source_message_id = ?`),
+		chatID, sourceMessageID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversation for message %d in chat %d: %w", sourceMessageID, chatID, err)
+	}
+	var messages []model.ChatMessage
+	if err := json.Unmarshal([]byte(data), &messages); err != nil {
+		return nil, fmt.Errorf("failed to parse conversation for message %d in chat %d: %w", sourceMessageID, chatID, err)
+	}
+	return messages, nil
+}
+
+func (s *SQLStore) SaveConversation(chatID int64, sourceMessageID int, messages []model.ChatMessage) error {
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return fmt.Errorf("failed to marshal conversation: %w", err)
+	}
+	_, err = s.db.Exec(s.rebind(`INSERT INTO conversations (chat_id, source_message_id, messages, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (chat_id, source_message_id) DO UPDATE SET messages = excluded.messages, updated_at = excluded.updated_at`),
+		chatID, sourceMessageID, string(data), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save conversation for message %d in chat %d: %w", sourceMessageID, chatID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetCachedTranscript(videoID, language string, notBefore time.Time) (*model.CachedTranscript, error) {
+	transcript := model.CachedTranscript{VideoID: videoID, Language: language}
+	var metadata, segments string
+	var createdAt int64
+	err := s.db.QueryRow(s.rebind(`SELECT source, metadata, text, duration, segments, created_at FROM video_transcripts
+		WHERE video_id = ? AND language = ? AND created_at >= ?`), videoID, language, notBefore.Unix()).Scan(
+		&transcript.Source, &metadata, &transcript.Text, &transcript.Duration, &segments, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cached transcript for %s: %w", videoID, err)
+	}
+	if err := json.Unmarshal([]byte(metadata), &transcript.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse cached metadata for %s: %w", videoID, err)
+	}
+	if err := json.Unmarshal([]byte(segments), &transcript.Segments); err != nil {
+		return nil, fmt.Errorf("failed to parse cached segments for %s: %w", videoID, err)
+	}
+	transcript.CreatedAt = time.Unix(createdAt, 0)
+	return &transcript, nil
+}
+
+func (s *SQLStore) SaveCachedTranscript(transcript *model.CachedTranscript) error {
+	metadata, err := json.Marshal(transcript.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal video metadata: %w", err)
+	}
+	segments, err := json.Marshal(transcript.Segments)
+	if err != nil {
+		return fmt.Errorf("failed to marshal transcript segments: %w", err)
+	}
+	if transcript.CreatedAt.IsZero() {
+		transcript.CreatedAt = time.Now()
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(s.rebind(`INSERT INTO video_transcripts (video_id, language, source, metadata, text, duration, segments, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (video_id, language) DO UPDATE SET source = excluded.source, metadata = excluded.metadata,
+			text = excluded.text, duration = excluded.duration, segments = excluded.segments, created_at = excluded.created_at`),
+		transcript.VideoID, transcript.Language, transcript.Source, string(metadata), transcript.Text,
+		transcript.Duration, string(segments), transcript.CreatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save cached transcript for %s: %w", transcript.VideoID, err)
+	}
+	_, err = tx.Exec(s.rebind(`DELETE FROM video_summaries WHERE video_id = ? AND language = ?`), transcript.VideoID, transcript.Language)
+	if err != nil {
+		return fmt.Errorf("failed to delete cached summaries for %s: %w", transcript.VideoID, err)
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) GetCachedSummary(videoID, language, variant string, notBefore time.Time) (*model.CachedSummary, error) {
+	summary := model.CachedSummary{VideoID: videoID, Language: language, Variant: variant}
+	var createdAt int64
+	err := s.db.QueryRow(s.rebind(`SELECT summary, created_at FROM video_summaries
+		WHERE video_id = ? AND language = ? AND variant = ? AND created_at >= ?`),
+		videoID, language, variant, notBefore.Unix()).Scan(&summary.Summary, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cached summary for %s: %w", videoID, err)
+	}
+	summary.CreatedAt = time.Unix(createdAt, 0)
+	return &summary, nil
+}
+
+func (s *SQLStore) SaveCachedSummary(summary *model.CachedSummary) error {
+	if summary.CreatedAt.IsZero() {
+		summary.CreatedAt = time.Now()
+	}
+	_, err := s.db.Exec(s.rebind(`INSERT INTO video_summaries (video_id, language, variant, summary, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (video_id, language, variant) DO UPDATE SET summary = excluded.summary, created_at = excluded.created_at`),
+		summary.VideoID, summary.Language, summary.Variant, summary.Summary, summary.CreatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save cached summary for %s: %w", summary.VideoID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) DeleteExpiredCache(before time.Time) (int64, error) {
+	var deleted int64
+	for _, table := range []string{"video_summaries", "video_transcripts"} {
+		result, err := s.db.Exec(s.rebind(`DELETE FROM `+table+` WHERE created_at < ?`), before.Unix())
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete expired rows from %s: %w", table, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete expired rows from %s: %w", table, err)
+		}
+		deleted += n
+	}
+	return deleted, nil
+}
+
+func (s *SQLStore) CreateBatch(batch *model.Batch) error {
+	entries, err := json.Marshal(batch.Entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal batch entries: %w", err)
+	}
+	now := time.Now()
+	batch.CreatedAt = now
+	batch.UpdatedAt = now
+	err = s.db.QueryRow(s.rebind(`INSERT INTO batches (user_id, chat_id, message_id, progress_message_id, source, title, entries, digest, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+		batch.UserID, batch.ChatID, batch.MessageID, batch.ProgressMessageID, batch.Source, batch.Title, string(entries),
+		boolToInt(batch.Digest), batch.Status, now.Unix(), now.Unix()).Scan(&batch.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create batch: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetBatch(id int64) (*model.Batch, error) {
+	batch := model.Batch{ID: id}
+	var entries string
+	var digest, createdAt, updatedAt int64
+	err := s.db.QueryRow(s.rebind(`SELECT user_id, chat_id, message_id, progress_message_id, source, title, entries, digest, status, created_at, updated_at
+		FROM batches WHERE id = ?`), id).Scan(&batch.UserID, &batch.ChatID, &batch.MessageID, &batch.ProgressMessageID,
+		&batch.Source, &batch.Title, &entries, &digest, &batch.Status, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load batch %d: %w", id, err)
+	}
+	if err := json.Unmarshal([]byte(entries), &batch.Entries); err != nil {
+		return nil, fmt.Errorf("failed to parse batch %d entries: %w", id, err)
+	}
+	batch.Digest = digest != 0
+	batch.CreatedAt = time.Unix(createdAt, 0)
+	batch.UpdatedAt = time.Unix(updatedAt, 0)
+	return &batch, nil
+}
+
+func (s *SQLStore) UpdateBatch(batch *model.Batch) error {
+	batch.UpdatedAt = time.Now()
+	_, err := s.db.Exec(s.rebind(`UPDATE batches SET progress_message_id = ?, digest = ?, status = ?, updated_at = ? WHERE id = ?`),
+		batch.ProgressMessageID, boolToInt(batch.Digest), batch.Status, batch.UpdatedAt.Unix(), batch.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update batch %d: %w", batch.ID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) ListBatchJobs(batchID int64) ([]model.Job, error) {
+	return s.queryJobs(`SELECT `+jobColumns+` FROM jobs WHERE batch_id = ? ORDER BY id`, batchID)
+}
+
+func (s *SQLStore) SetBatchStatus(id int64, from, to string) (bool, error) {
+	result, err := s.db.Exec(s.rebind(`UPDATE batches SET status = ?, updated_at = ? WHERE id = ? AND status = ?`),
+		to, time.Now().Unix(), id, from)
+	if err != nil {
+		return false, fmt.Errorf("failed to set batch %d status: %w", id, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to set batch %d status: %w", id, err)
+	}
+	return n == 1, nil
+}
+
+func (s *SQLStore) IsAllowed(subjectType string, subjectID int64) (bool, error) {
+	var n int
+	err := s.db.QueryRow(s.rebind(`SELECT COUNT(*) FROM allowlist WHERE subject_type = ? AND subject_id = ?`),
+		subjectType, subjectID).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to check access for %s %d: %w", subjectType, subjectID, err)
+	}
+	return n > 0, nil
+}
+
+func (s *SQLStore) Allow(subjectType string, subjectID, addedBy int64) error {
+	return s.allow(s.db, subjectType, subjectID, addedBy)
+}
+
+func (s *SQLStore) allow(db interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}, subjectType string, subjectID, addedBy int64) error {
+	_, err := db.Exec(s.rebind(`INSERT INTO allowlist (subject_type, subject_id, added_by, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (subject_type, subject_id) DO NOTHING`), subjectType, subjectID, addedBy, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to allow %s %d: %w", subjectType, subjectID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Disallow(subjectType string, subjectID int64) error {
+	_, err := s.db.Exec(s.rebind(`DELETE FROM allowlist WHERE subject_type = ? AND subject_id = ?`), subjectType, subjectID)
+	if err != nil {
+		return fmt.Errorf("failed to disallow %s %d: %w", subjectType, subjectID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) CreateInvite(invite *model.Invite) error {
+	if invite.CreatedAt.IsZero() {
+		invite.CreatedAt = time.Now()
+	}
+	_, err := s.db.Exec(s.rebind(`INSERT INTO invites (code, created_by, created_at, expires_at) VALUES (?, ?, ?, ?)`),
+		invite.Code, invite.CreatedBy, invite.CreatedAt.Unix(), invite.ExpiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to create invite: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) RedeemInvite(code string, userID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	// Условный UPDATE: один и тот же код не активируется дважды, даже одновременно
+	result, err := tx.Exec(s.rebind(`UPDATE invites SET used_by = ?, used_at = ? WHERE code = ? AND used_by = 0 AND expires_at > ?`),
+		userID, now, code, now)
+	if err != nil {
+		return fmt.Errorf("failed to redeem invite: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to redeem invite: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	var createdBy int64
+	if err := tx.QueryRow(s.rebind(`SELECT created_by FROM invites WHERE code = ?`), code).Scan(&createdBy); err != nil {
+		return fmt.Errorf("failed to load invite: %w", err)
+	}
+	if err := s.allow(tx, model.AccessSubjectUser, userID, createdBy); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) Ban(ban *model.Ban) error {
+	if ban.CreatedAt.IsZero() {
+		ban.CreatedAt = time.Now()
+	}
+	_, err := s.db.Exec(s.rebind(`INSERT INTO bans (user_id, banned_by, reason, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET banned_by = excluded.banned_by, reason = excluded.reason, created_at = excluded.created_at`),
+		ban.UserID, ban.BannedBy, ban.Reason, ban.CreatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to ban user %d: %w", ban.UserID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Unban(userID int64) (bool, error) {
+	result, err := s.db.Exec(s.rebind(`DELETE FROM bans WHERE user_id = ?`), userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to unban user %d: %w", userID, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to unban user %d: %w", userID, err)
+	}
+	return n > 0, nil
+}
+
+func (s *SQLStore) IsBanned(userID int64) (bool, error) {
+	var n int
+	if err := s.db.QueryRow(s.rebind(`SELECT COUNT(*) FROM bans WHERE user_id = ?`), userID).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to check ban for user %d: %w", userID, err)
+	}
+	return n > 0, nil
+}
+
+func (s *SQLStore) ListBans() ([]model.Ban, error) {
+	rows, err := s.db.Query(`SELECT user_id, banned_by, reason, created_at FROM bans ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bans: %w", err)
+	}
+	defer rows.Close()
+
+	var bans []model.Ban
+	for rows.Next() {
+		var ban model.Ban
+		var createdAt int64
+		if err := rows.Scan(&ban.UserID, &ban.BannedBy, &ban.Reason, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan ban: %w", err)
+		}
+		ban.CreatedAt = time.Unix(createdAt, 0)
+		bans = append(bans, ban)
+	}
+	return bans, rows.Err()
+}
+
+func (s *SQLStore) AddUsage(userID int64, kind string, window time.Time, amount float64) error {
+	_, err := s.db.Exec(s.rebind(`INSERT INTO quota_usage (user_id, kind, window_start, amount) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, kind, window_start) DO UPDATE SET amount = quota_usage.amount + excluded.amount`),
+		userID, kind, window.Unix(), amount)
+	if err != nil {
+		return fmt.Errorf("failed to add %s usage for user %d: %w", kind, userID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) ReserveUsage(userID int64, kind string, window time.Time, amount, limit float64) (bool, error) {
+	if _, err := s.db.Exec(s.rebind(`INSERT INTO quota_usage (user_id, kind, window_start, amount) VALUES (?, ?, ?, 0)
+		ON CONFLICT (user_id, kind, window_start) DO NOTHING`),
+		userID, kind, window.Unix()); err != nil {
+		return false, fmt.Errorf("failed to reserve %s usage for user %d: %w", kind, userID, err)
+	}
+	// Условие проверяется под блокировкой строки, поэтому параллельные запросы не превысят лимит
+	result, err := s.db.Exec(s.rebind(`UPDATE quota_usage SET amount = amount + ?
+		WHERE user_id = ? AND kind = ? AND window_start = ? AND amount + ? <= ?`),
+		amount, userID, kind, window.Unix(), amount, limit)
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve %s usage for user %d: %w", kind, userID, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (s *SQLStore) ReleaseUsage(userID int64, kind string, window time.Time, amount float64) error {
+	_, err := s.db.Exec(s.rebind(`UPDATE quota_usage SET amount = CASE WHEN amount > ? THEN amount - ? ELSE 0 END
+		WHERE user_id = ? AND kind = ? AND window_start = ?`),
+		amount, amount, userID, kind, window.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to release %s usage for user %d: %w", kind, userID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetUsage(userID int64, kind string, window time.Time) (float64, error) {
+	var total float64
+	err := s.db.QueryRow(s.rebind(`SELECT amount FROM quota_usage WHERE user_id = ? AND kind = ? AND window_start = ?`),
+		userID, kind, window.Unix()).Scan(&total)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get %s usage for user %d: %w", kind, userID, err)
+	}
+	return total, nil
+}
+
+func (s *SQLStore) GetQuotaLimits(userID int64) (model.QuotaLimits, error) {
+	var limits model.QuotaLimits
+	err := s.db.QueryRow(s.rebind(`SELECT audio_minutes_per_day, summaries_per_hour, max_duration_minutes FROM quota_overrides WHERE user_id = ?`),
+		userID).Scan(&limits.AudioMinutesPerDay, &limits.SummariesPerHour, &limits.MaxDurationMinutes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return limits, ErrNotFound
+	}
+	if err != nil {
+		return limits, fmt.Errorf("failed to get quota limits for user %d: %w", userID, err)
+	}
+	return limits, nil
+}
+
+func (s *SQLStore) SetQuotaLimits(userID int64, limits model.QuotaLimits) error {
+	_, err := s.db.Exec(s.rebind(`INSERT INTO quota_overrides (user_id, audio_minutes_per_day, summaries_per_hour, max_duration_minutes, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET audio_minutes_per_day = excluded.audio_minutes_per_day,
+			summaries_per_hour = excluded.summaries_per_hour, max_duration_minutes = excluded.max_duration_minutes,
+			updated_at = excluded.updated_at`),
+		userID, limits.AudioMinutesPerDay, limits.SummariesPerHour, limits.MaxDurationMinutes, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to set quota limits for user %d: %w", userID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) DeleteQuotaLimits(userID int64) error {
+	_, err := s.db.Exec(s.rebind(`DELETE FROM quota_overrides WHERE user_id = ?`), userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete quota limits for user %d: %w", userID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) DeleteUsageBefore(before time.Time) (int64, error) {
+	result, err := s.db.Exec(s.rebind(`DELETE FROM quota_usage WHERE window_start < ?`), before.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete quota usage: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (s *SQLStore) SaveUsageRecord(record *model.UsageRecord) error {
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	err := s.db.QueryRow(s.rebind(`INSERT INTO usage_records
+		(user_id, chat_id, kind, model, prompt_tokens, completion_tokens, audio_seconds, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+		record.UserID, record.ChatID, record.Kind, record.Model, record.PromptTokens, record.CompletionTokens,
+		record.AudioSeconds, record.CreatedAt.Unix()).Scan(&record.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save usage record: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) UsageTotals(userID int64, since time.Time) ([]model.UsageTotal, error) {
+	query := `SELECT user_id, kind, model, COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0),
+		COALESCE(SUM(audio_seconds), 0) FROM usage_records WHERE created_at >= ?`
+	args := []any{since.Unix()}
+	if userID != 0 {
+		query += ` AND user_id = ?`
+		args = append(args, userID)
+	}
+	query += ` GROUP BY user_id, kind, model ORDER BY user_id, kind, model`
+
+	rows, err := s.db.Query(s.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage totals: %w", err)
+	}
+	defer rows.Close()
+	var totals []model.UsageTotal
+	for rows.Next() {
+		var total model.UsageTotal
+		if err := rows.Scan(&total.UserID, &total.Kind, &total.Model, &total.Requests, &total.PromptTokens,
+			&total.CompletionTokens, &total.AudioSeconds); err != nil {
+			return nil, fmt.Errorf("failed to scan usage totals: %w", err)
+		}
+		totals = append(totals, total)
+	}
+	return totals, rows.Err()
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var _ Repository = (*SQLStore)(nil)
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"errors"
+	"main/internal/model"
+	"time"
+)
+
+// ErrNotFound возвращается, когда запись не найдена
+var ErrNotFound = errors.New("storage: not found")
+
+// SettingsStore хранилище пользовательских настроек
+type SettingsStore interface {
+	// GetSettings возвращает настройки пользователя или пустые настройки, если он их не менял
+	GetSettings(userID int64) (model.UserSettings, error)
+	SaveSettings(userID int64, settings model.UserSettings) error
+}
+
+// UserRepository пользователи бота
+type UserRepository interface {
+	// UpsertUser добавляет пользователя или обновляет его имя и время последней активности
+	UpsertUser(user model.User) error
+	GetUser(id int64) (*model.User, error)
+	ListUsers() ([]model.User, error)
+	// ListChatIDs возвращает все известные боту чаты: личные чаты пользователей, чаты задач и разрешенные группы
+	ListChatIDs() ([]int64, error)
+}
+
+// JobRepository задачи на обработку
+type JobRepository interface {
+	// CreateJob сохраняет новую задачу и заполняет job.ID; незаданный CreatedAt - текущее время
+	CreateJob(job *model.Job) error
+	// UpdateJob сохраняет статус и результат выполняющейся задачи, только если она все еще в активном статусе
+	// и не была забрана заново (job.Attempt совпадает). false - задачу вернули в очередь или забрал другой воркер
+	UpdateJob(job *model.Job) (bool, error)
+	GetJob(id int64) (*model.Job, error)
+	// ListJobsByStatus возвращает задачи с любым из указанных статусов в порядке создания
+	ListJobsByStatus(statuses ...string) ([]model.Job, error)
+	// ClaimNextJob атомарно переводит самую старую задачу из статуса queued в status, увеличивает ее Attempt
+	// и возвращает ее. Если очередь пуста, возвращает ErrNotFound.
+	ClaimNextJob(status string) (*model.Job, error)
+	// TouchJob обновляет updated_at задачи, показывая, что воркер еще жив; задачу, забранную заново, не трогает
+	TouchJob(id int64, attempt int) error
+	// CancelQueuedJob переводит задачу в cancelled, только если она еще не начала выполняться
+	CancelQueuedJob(id int64) (bool, error)
+	// RequestJobCancel выставляет флаг отмены для выполняющейся задачи
+	RequestJobCancel(id int64) error
+	// RequeueStaleJobs возвращает в очередь задачи с указанными статусами, не обновлявшиеся с olderThan
+	RequeueStaleJobs(statuses []string, olderThan time.Time) (int64, error)
+	// CountJobsByStatus считает задачи, созданные с момента since, по статусам
+	CountJobsByStatus(since time.Time) (map[string]int, error)
+}
+
+// TranscriptRepository результаты распознавания
+type TranscriptRepository interface {
+	// SaveTranscript сохраняет транскрипт; повторное сохранение для того же сообщения перезаписывает его
+	SaveTranscript(transcript *model.StoredTranscript) error
+	GetTranscript(chatID int64, messageID int) (*model.StoredTranscript, error)
+}
+
+// ConversationRepository история вопросов и ответов по транскриптам
+type ConversationRepository interface {
+	// LinkMessage связывает сообщение бота с исходным сообщением, по транскрипту которого оно отправлено
+	LinkMessage(chatID int64, messageID, sourceMessageID int) error
+	// GetLinkedSource возвращает исходное сообщение для сообщения бота или ErrNotFound
+	GetLinkedSource(chatID int64, messageID int) (int, error)
+	// GetConversation возвращает историю диалога (без системного промпта) или пустой список
+	GetConversation(chatID int64, sourceMessageID int) ([]model.ChatMessage, error)
+	SaveConversation(chatID int64, sourceMessageID int, messages []model.ChatMessage) error
+}
+
+// CacheRepository кэш транскриптов и результатов по видео, общий для всех пользователей
+type CacheRepository interface {
+	// GetCachedTranscript возвращает транскрипт, сохраненный не раньше notBefore, или ErrNotFound
+	GetCachedTranscript(videoID, language string, notBefore time.Time) (*model.CachedTranscript, error)
+	// SaveCachedTranscript сохраняет транскрипт и удаляет результаты, построенные по прежнему транскрипту
+	SaveCachedTranscript(transcript *model.CachedTranscript) error
+	GetCachedSummary(videoID, language, variant string, notBefore time.Time) (*model.CachedSummary, error)
+	SaveCachedSummary(summary *model.CachedSummary) error
+	// DeleteExpiredCache удаляет записи кэша, сохраненные раньше before
+	DeleteExpiredCache(before time.Time) (int64, error)
+}
+
+// BatchRepository пакетная обработка плейлистов
+type BatchRepository interface {
+	// CreateBatch сохраняет пакет и заполняет batch.ID
+	CreateBatch(batch *model.Batch) error
+	GetBatch(id int64) (*model.Batch, error)
+	UpdateBatch(batch *model.Batch) error
+	// ListBatchJobs возвращает задачи пакета в порядке создания
+	ListBatchJobs(batchID int64) ([]model.Job, error)
+	// SetBatchStatus переводит пакет из статуса from в to; false, если пакет уже не в статусе from
+	// (его перевел другой воркер или реплика)
+	SetBatchStatus(id int64, from, to string) (bool, error)
+}
+
+// AccessRepository список доступа и коды приглашений
+type AccessRepository interface {
+	// IsAllowed проверяет, есть ли пользователь или группа (model.AccessSubject*) в списке доступа
+	IsAllowed(subjectType string, subjectID int64) (bool, error)
+	Allow(subjectType string, subjectID, addedBy int64) error
+	Disallow(subjectType string, subjectID int64) error
+	CreateInvite(invite *model.Invite) error
+	// RedeemInvite отмечает код использованным и добавляет пользователя в список доступа.
+	// Несуществующий, использованный или просроченный код - ErrNotFound.
+	RedeemInvite(code string, userID int64) error
+	// Ban блокирует пользователя; повторная блокировка обновляет причину
+	Ban(ban *model.Ban) error
+	// Unban снимает блокировку; false, если пользователь не был заблокирован
+	Unban(userID int64) (bool, error)
+	IsBanned(userID int64) (bool, error)
+	ListBans() ([]model.Ban, error)
+}
+
+// QuotaRepository расход и индивидуальные лимиты квот пользователей
+type QuotaRepository interface {
+	// AddUsage добавляет amount к расходу квоты вида kind (model.QuotaUsage*) в окне, начавшемся в window
+	AddUsage(userID int64, kind string, window time.Time, amount float64) error
+	// ReserveUsage атомарно добавляет amount к расходу в окне, если сумма не превысит limit;
+	// false - квоты не хватает, расход не изменен
+	ReserveUsage(userID int64, kind string, window time.Time, amount, limit float64) (bool, error)
+	// ReleaseUsage уменьшает расход в окне на amount, но не ниже нуля
+	ReleaseUsage(userID int64, kind string, window time.Time, amount float64) error
+	// GetUsage возвращает расход квоты вида kind в окне, начавшемся в window
+	GetUsage(userID int64, kind string, window time.Time) (float64, error)
+	// GetQuotaLimits возвращает лимиты, назначенные пользователю администратором, или ErrNotFound
+	GetQuotaLimits(userID int64) (model.QuotaLimits, error)
+	SetQuotaLimits(userID int64, limits model.QuotaLimits) error
+	DeleteQuotaLimits(userID int64) error
+	// DeleteUsageBefore удаляет расход в окнах, начавшихся раньше before
+	DeleteUsageBefore(before time.Time) (int64, error)
+}
+
+// UsageRepository учет расхода токенов и секунд распознанного аудио
+type UsageRepository interface {
+	SaveUsageRecord(record *model.UsageRecord) error
+	// UsageTotals суммирует расход с момента since по пользователям и моделям; userID 0 - все пользователи
+	UsageTotals(userID int64, since time.Time) ([]model.UsageTotal, error)
+}
+
+// Repository общее хранилище бота
+type Repository interface {
+	SettingsStore
+	UserRepository
+	JobRepository
+	TranscriptRepository
+	ConversationRepository
+	CacheRepository
+	BatchRepository
+	AccessRepository
+	QuotaRepository
+	UsageRepository
+	Close() error
+}
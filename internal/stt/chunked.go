@@ -0,0 +1,182 @@
+package stt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"main/internal/audio"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Максимальное число слов, которое ищется в перекрытии соседних фрагментов
+const maxOverlapWords = 60
+
+// ChunkedTranscriber режет большие файлы на перекрывающиеся фрагменты, распознает их параллельно
+// ограниченным пулом воркеров и склеивает текст по порядку, убирая повторы на стыках.
+// Файлы не больше maxBytes и не длиннее одного фрагмента передаются во вложенный Transcriber как есть:
+// длинный, но сжатый файл укладывается в лимит размера, но не успевает распознаться за таймаут запроса.
+type ChunkedTranscriber struct {
+	inner    Transcriber
+	maxBytes int64
+	workers  int
+	split    audio.SplitOptions
+}
+
+func NewChunkedTranscriber(inner Transcriber, maxBytes int64, workers int, split audio.SplitOptions) *ChunkedTranscriber {
+	if workers < 1 {
+		workers = 1
+	}
+	return &ChunkedTranscriber{
+		inner:    inner,
+		maxBytes: maxBytes,
+		workers:  workers,
+		split:    split,
+	}
+}
+
+func (t *ChunkedTranscriber) Name() string {
+	return t.inner.Name()
+}
+
+func (t *ChunkedTranscriber) Transcribe(ctx context.Context, audioFilePath string, opts Options) (*Transcript, error) {
+	fileInfo, err := os.Stat(audioFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat audio file %s: %w", audioFilePath, err)
+	}
+	if fileInfo.Size() <= t.maxBytes && !t.longerThanChunk(ctx, audioFilePath) {
+		return t.inner.Transcribe(ctx, audioFilePath, opts)
+	}
+
+	chunkDir, err := os.MkdirTemp("", "stt-chunks-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir for audio chunks: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(chunkDir); err != nil {
+			log.Printf("Error removing temp chunk dir %s: %v", chunkDir, err)
+		}
+	}()
+
+	segments, err := audio.Split(ctx, audioFilePath, chunkDir, t.split)
+	if err != nil {
+		return nil, fmt.Errorf("failed to split audio file %s: %w", audioFilePath, err)
+	}
+	log.Printf("STT: %s (%d bytes) split into %d chunks", audioFilePath, fileInfo.Size(), len(segments))
+
+	results := make([]*Transcript, len(segments))
+	errs := make([]error, len(segments))
+	jobs := make(chan audio.Segment)
+	var wg sync.WaitGroup
+	for w := 0; w < t.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for segment := range jobs {
+				results[segment.Index], errs[segment.Index] = t.inner.Transcribe(ctx, segment.Path, opts)
+			}
+		}()
+	}
+	for _, segment := range segments {
+		jobs <- segment
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("failed to transcribe chunk %d/%d [%.0fs-%.0fs]: %w",
+				i+1, len(segments), segments[i].Start, segments[i].End, err)
+		}
+	}
+
+	return mergeTranscripts(segments, results), nil
+}
+
+// mergeTranscripts собирает общий результат: таймкоды фрагментов сдвигаются на начало куска,
+// а фрагменты, начавшиеся в перекрытии до границы предыдущего куска, отбрасываются
+// longerThanChunk проверяет, что аудио длиннее одного фрагмента. Если длительность не определилась,
+// файл считается коротким и решает только размер.
+func (t *ChunkedTranscriber) longerThanChunk(ctx context.Context, audioFilePath string) bool {
+	if t.split.ChunkSeconds <= 0 {
+		return false
+	}
+	duration, err := audio.Duration(ctx, audioFilePath)
+	if err != nil {
+		log.Printf("STT: failed to get duration of %s, chunking by size only: %v", audioFilePath, err)
+		return false
+	}
+	return duration > t.split.ChunkSeconds
+}
+
+func mergeTranscripts(chunks []audio.Segment, results []*Transcript) *Transcript {
+	merged := &Transcript{}
+	texts := make([]string, len(results))
+	for i, result := range results {
+		texts[i] = result.Text
+		if merged.Language == "" {
+			merged.Language = result.Language
+		}
+		prevEnd := 0.0
+		if i > 0 {
+			prevEnd = chunks[i-1].End
+		}
+		for _, segment := range result.Segments {
+			segment.Start += chunks[i].Start
+			segment.End += chunks[i].Start
+			if segment.Start < prevEnd {
+				continue
+			}
+			segment.ID = len(merged.Segments)
+			merged.Segments = append(merged.Segments, segment)
+		}
+	}
+	merged.Text = mergeTexts(texts)
+	if len(chunks) > 0 {
+		merged.Duration = chunks[len(chunks)-1].End
+	}
+	return merged
+}
+
+// mergeTexts склеивает тексты соседних фрагментов, отбрасывая в начале каждого
+// следующего фрагмента слова, которые уже были в конце предыдущего (перекрытие)
+func mergeTexts(texts []string) string {
+	var merged []string
+	for _, text := range texts {
+		words := strings.Fields(text)
+		if len(words) == 0 {
+			continue
+		}
+		skip := overlapLength(merged, words)
+		merged = append(merged, words[skip:]...)
+	}
+	return strings.Join(merged, " ")
+}
+
+// overlapLength ищет самое длинное совпадение суффикса prev с префиксом next (без учета регистра и пунктуации)
+func overlapLength(prev, next []string) int {
+	limit := min(len(prev), len(next), maxOverlapWords)
+	for n := limit; n >= 2; n-- {
+		if wordsEqual(prev[len(prev)-n:], next[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+func wordsEqual(a, b []string) bool {
+	for i := range a {
+		if normalizeWord(a[i]) != normalizeWord(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeWord(word string) string {
+	return strings.ToLower(strings.TrimFunc(word, func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSymbol(r)
+	}))
+}
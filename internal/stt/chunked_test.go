@@ -0,0 +1,60 @@
+package stt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOverlapLength(t *testing.T) {
+	tests := []struct {
+		name string
+		prev string
+		next string
+		want int
+	}{
+		{"no overlap", "раз два три", "четыре пять", 0},
+		{"single word is not enough", "раз два три", "три четыре", 0},
+		{"two words", "раз два три", "два три четыре", 2},
+		{"case and punctuation ignored", "Он сказал: привет, мир.", "Привет мир! Как дела", 2},
+		{"whole next chunk", "раз два три", "два три", 2},
+		{"longest match wins", "а б а б", "а б а б в", 4},
+		{"empty prev", "", "раз два", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := overlapLength(strings.Fields(tt.prev), strings.Fields(tt.next))
+			if got != tt.want {
+				t.Errorf("overlapLength(%q, %q) = %d, want %d", tt.prev, tt.next, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverlapLengthLimit(t *testing.T) {
+	words := strings.Fields(strings.Repeat("слово ", maxOverlapWords+10))
+	if got := overlapLength(words, words); got != maxOverlapWords {
+		t.Errorf("overlapLength() = %d, want %d", got, maxOverlapWords)
+	}
+}
+
+func TestMergeTexts(t *testing.T) {
+	tests := []struct {
+		name  string
+		texts []string
+		want  string
+	}{
+		{"empty", nil, ""},
+		{"single", []string{"раз два три"}, "раз два три"},
+		{"overlap removed", []string{"раз два три", "два три четыре пять"}, "раз два три четыре пять"},
+		{"no overlap kept", []string{"раз два", "три четыре"}, "раз два три четыре"},
+		{"empty chunks skipped", []string{"раз два три", "  ", "два три четыре"}, "раз два три четыре"},
+		{"whitespace normalized", []string{"раз\nдва  три", "три\tчетыре"}, "раз два три три четыре"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeTexts(tt.texts); got != tt.want {
+				t.Errorf("mergeTexts(%q) = %q, want %q", tt.texts, got, tt.want)
+			}
+		})
+	}
+}
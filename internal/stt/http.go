@@ -0,0 +1,144 @@
+package stt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"main/internal/metrics"
+	"main/internal/model"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPTranscriber работает с OpenAI-совместимым эндпоинтом /audio/transcriptions (Bothub, OpenAI и т.п.)
+type HTTPTranscriber struct {
+	name     string
+	url      string
+	token    string
+	model    string
+	language string // язык по умолчанию (STT_LANGUAGE); пустая строка - автоопределение
+	client   *http.Client
+}
+
+func NewHTTPTranscriber(name, url, token, model, language string) *HTTPTranscriber {
+	return &HTTPTranscriber{
+		name:     name,
+		url:      url,
+		token:    token,
+		model:    model,
+		language: language,
+		client:   &http.Client{Timeout: 60 * time.Second}, // Увеличен таймаут для потенциально больших файлов
+	}
+}
+
+func (t *HTTPTranscriber) Name() string {
+	return t.name
+}
+
+func (t *HTTPTranscriber) Transcribe(ctx context.Context, audioFilePath string, opts Options) (*Transcript, error) {
+	log.Printf("STT: Processing %s with %s API", audioFilePath, t.name)
+
+	file, err := os.Open(audioFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audio file %s: %w", audioFilePath, err)
+	}
+	defer file.Close()
+
+	var requestBody bytes.Buffer
+	multipartWriter := multipart.NewWriter(&requestBody)
+
+	fileWriter, err := multipartWriter.CreateFormFile("file", filepath.Base(audioFilePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create form file for %s: %w", audioFilePath, err)
+	}
+	_, err = io.Copy(fileWriter, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy file content to multipart writer: %w", err)
+	}
+
+	// verbose_json возвращает фрагменты с таймкодами, они нужны для субтитров
+	fields := [][2]string{
+		{"model", t.model},
+		{"response_format", "verbose_json"},
+		{"timestamp_granularities[]", "segment"},
+	}
+	language := t.language
+	if opts.Language != "" {
+		language = opts.Language
+	}
+	if language != "" {
+		fields = append(fields, [2]string{"language", language})
+	}
+	for _, field := range fields {
+		if err := multipartWriter.WriteField(field[0], field[1]); err != nil {
+			return nil, fmt.Errorf("failed to write %s field to multipart writer: %w", field[0], err)
+		}
+	}
+
+	err = multipartWriter.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.url, &requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new HTTP request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	req.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		metrics.APIResponses.WithLabelValues("transcriptions", strings.ToLower(t.name), "error").Inc()
+		return nil, fmt.Errorf("failed to execute HTTP request to %s API: %w", t.name, err)
+	}
+	defer resp.Body.Close()
+	metrics.APIResponses.WithLabelValues("transcriptions", strings.ToLower(t.name), strconv.Itoa(resp.StatusCode)).Inc()
+
+	responseBodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body from %s API: %w", t.name, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("%s API returned non-OK status: %s. Response: %s", t.name, resp.Status, string(responseBodyBytes))
+		var errorResp model.TranscriptionResponse
+		if json.Unmarshal(responseBodyBytes, &errorResp) == nil && errorResp.Error != nil {
+			return nil, fmt.Errorf("%s API error: %s (Type: %s, Code: %s, Param: %s), HTTP Status: %s",
+				t.name, errorResp.Error.Message, errorResp.Error.Type, errorResp.Error.Code, errorResp.Error.Param, resp.Status)
+		}
+		return nil, fmt.Errorf("%s API request failed with status %s and body: %s", t.name, resp.Status, string(responseBodyBytes))
+	}
+
+	var transcriptionResp model.TranscriptionResponse
+	err = json.Unmarshal(responseBodyBytes, &transcriptionResp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON response from %s API (%s): %w. Response body: %s", t.name, resp.Status, err, string(responseBodyBytes))
+	}
+
+	if transcriptionResp.Error != nil {
+		return nil, fmt.Errorf("%s API returned an error in JSON response: %s (Type: %s)", t.name, transcriptionResp.Error.Message, transcriptionResp.Error.Type)
+	}
+	if transcriptionResp.Text == "" {
+		log.Printf("Warning: %s API returned OK status but no text. Response: %s", t.name, string(responseBodyBytes))
+		// Не возвращаем ошибку, если текст просто пустой, но нет явной ошибки API.
+		// Это может означать тишину в аудио.
+	}
+
+	log.Printf("STT: Successfully recognized text (%d segments): \"%s\"", len(transcriptionResp.Segments), transcriptionResp.Text)
+	return &Transcript{
+		Text:     transcriptionResp.Text,
+		Language: transcriptionResp.Language,
+		Duration: transcriptionResp.Duration,
+		Segments: transcriptionResp.Segments,
+	}, nil
+}
@@ -0,0 +1,138 @@
+package stt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"main/internal/audio"
+	"main/internal/model"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Аргументы по умолчанию рассчитаны на whisper.cpp (whisper-cli): вывод текста с таймкодами в stdout
+var defaultLocalArgs = []string{"-m", "{model}", "-f", "{input}", "-l", "{language}", "-np"}
+
+// Строка вывода whisper.cpp: [00:00:00.000 --> 00:00:04.500]  текст
+var whisperLineRegex = regexp.MustCompile(`^\[(\d+):(\d{2}):(\d{2}(?:[.,]\d+)?) --> (\d+):(\d{2}):(\d{2}(?:[.,]\d+)?)\]\s*(.*)$`)
+
+// LocalTranscriber запускает локальный распознаватель (whisper.cpp, faster-whisper и т.п.) как внешний процесс
+// и читает распознанный текст из stdout. Если строки вывода содержат таймкоды в формате whisper.cpp,
+// они разбираются во фрагменты.
+// В аргументах поддерживаются подстановки {input}, {model} и {language}.
+type LocalTranscriber struct {
+	command  string
+	args     []string
+	model    string
+	language string
+}
+
+func NewLocalTranscriber(command string, args []string, model, language string) *LocalTranscriber {
+	if len(args) == 0 {
+		args = defaultLocalArgs
+	}
+	if language == "" {
+		language = "auto"
+	}
+	return &LocalTranscriber{
+		command:  command,
+		args:     args,
+		model:    model,
+		language: language,
+	}
+}
+
+func (t *LocalTranscriber) Name() string {
+	return "local " + filepath.Base(t.command)
+}
+
+func (t *LocalTranscriber) Transcribe(ctx context.Context, audioFilePath string, opts Options) (*Transcript, error) {
+	log.Printf("STT: Processing %s with %s", audioFilePath, t.Name())
+
+	// whisper.cpp принимает только 16 кГц моно WAV, поэтому остальные форматы предварительно конвертируем
+	inputPath := audioFilePath
+	if !strings.EqualFold(filepath.Ext(audioFilePath), ".wav") {
+		wavTempFile, err := os.CreateTemp("", "stt-*.wav")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp wav file: %w", err)
+		}
+		wavPath := wavTempFile.Name()
+		wavTempFile.Close()
+		defer audio.RemoveFile(wavPath)
+
+		if err := audio.ConvertToWav(ctx, audioFilePath, wavPath); err != nil {
+			return nil, err
+		}
+		inputPath = wavPath
+	}
+
+	language := t.language
+	if opts.Language != "" {
+		language = opts.Language
+	}
+	replacer := strings.NewReplacer("{input}", inputPath, "{model}", t.model, "{language}", language)
+	args := make([]string, 0, len(t.args))
+	for _, arg := range t.args {
+		args = append(args, replacer.Replace(arg))
+	}
+
+	cmd := exec.CommandContext(ctx, t.command, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		log.Printf("%s error for %s: %v\nOutput: %s", t.command, inputPath, err, stderr.String())
+		return nil, fmt.Errorf("%s failed: %w. Output: %s", t.command, err, stderr.String())
+	}
+
+	transcript := parseLocalOutput(stdout.String())
+	if transcript.Text == "" {
+		log.Printf("Warning: %s returned no text. Output: %s", t.command, stderr.String())
+	}
+
+	log.Printf("STT: Successfully recognized text (%d segments): \"%s\"", len(transcript.Segments), transcript.Text)
+	return transcript, nil
+}
+
+func parseLocalOutput(output string) *Transcript {
+	var segments []model.TranscriptionSegment
+	var texts []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		m := whisperLineRegex.FindStringSubmatch(line)
+		if m == nil {
+			texts = append(texts, line)
+			continue
+		}
+		text := strings.TrimSpace(m[7])
+		segments = append(segments, model.TranscriptionSegment{
+			ID:    len(segments),
+			Start: parseClock(m[1], m[2], m[3]),
+			End:   parseClock(m[4], m[5], m[6]),
+			Text:  text,
+		})
+		texts = append(texts, text)
+	}
+
+	transcript := &Transcript{Text: strings.Join(texts, " "), Segments: segments}
+	if len(segments) > 0 {
+		transcript.Duration = segments[len(segments)-1].End
+	}
+	return transcript
+}
+
+func parseClock(hours, minutes, seconds string) float64 {
+	h, _ := strconv.Atoi(hours)
+	m, _ := strconv.Atoi(minutes)
+	s, _ := strconv.ParseFloat(strings.Replace(seconds, ",", ".", 1), 64)
+	return float64(h*3600+m*60) + s
+}
@@ -0,0 +1,119 @@
+package stt
+
+import (
+	"context"
+	"fmt"
+	"main/internal/audio"
+	"main/internal/config"
+	"main/internal/metrics"
+	"main/internal/model"
+	"strings"
+	"time"
+)
+
+const (
+	ProviderBothub = "bothub"
+	ProviderOpenAI = "openai"
+	ProviderLocal  = "local"
+
+	bothubTranscriptionsURL = "https://bothub.chat/api/v2/openai/v1/audio/transcriptions"
+	openAITranscriptionsURL = "https://api.openai.com/v1/audio/transcriptions"
+	defaultAudioModel       = "whisper-1"
+)
+
+// Transcript результат распознавания: текст и, если провайдер их отдает, фрагменты с таймкодами
+type Transcript struct {
+	Text     string
+	Language string
+	Duration float64 // секунды
+	Segments []model.TranscriptionSegment
+}
+
+// Options параметры отдельного запроса на распознавание
+type Options struct {
+	Language string // код языка ISO-639-1; пустая строка - автоопределение
+}
+
+// Transcriber распознает речь из аудиофайла
+type Transcriber interface {
+	Name() string
+	Transcribe(ctx context.Context, audioFilePath string, opts Options) (*Transcript, error)
+}
+
+// AudioModel имя модели распознавания для учета расходов: STT_MODEL у HTTP-провайдеров, "local" у локального
+func AudioModel(cfg *config.Config) string {
+	if strings.ToLower(cfg.SttProvider) == ProviderLocal {
+		return ProviderLocal
+	}
+	if cfg.SttModel == "" {
+		return defaultAudioModel
+	}
+	return cfg.SttModel
+}
+
+// New создает Transcriber по провайдеру, указанному в конфиге (STT_PROVIDER)
+func New(cfg *config.Config) (Transcriber, error) {
+	model := cfg.SttModel
+	if model == "" {
+		model = defaultAudioModel
+	}
+
+	switch strings.ToLower(cfg.SttProvider) {
+	case "", ProviderBothub:
+		token := cfg.SttApiToken
+		if token == "" {
+			token = cfg.BothubApiToken
+		}
+		url := cfg.SttApiURL
+		if url == "" {
+			url = bothubTranscriptionsURL
+		}
+		return withMetrics(ProviderBothub, withChunking(NewHTTPTranscriber("Bothub", url, token, model, cfg.SttLanguage), cfg)), nil
+	case ProviderOpenAI:
+		if cfg.SttApiToken == "" {
+			return nil, fmt.Errorf("STT_API_TOKEN must be set for provider %q", ProviderOpenAI)
+		}
+		url := cfg.SttApiURL
+		if url == "" {
+			url = openAITranscriptionsURL
+		}
+		return withMetrics(ProviderOpenAI, withChunking(NewHTTPTranscriber("OpenAI", url, cfg.SttApiToken, model, cfg.SttLanguage), cfg)), nil
+	case ProviderLocal:
+		if cfg.SttLocalCommand == "" {
+			return nil, fmt.Errorf("STT_LOCAL_COMMAND must be set for provider %q", ProviderLocal)
+		}
+		return withMetrics(ProviderLocal, NewLocalTranscriber(cfg.SttLocalCommand, cfg.SttLocalArgs, cfg.SttLocalModel, cfg.SttLanguage)), nil
+	default:
+		return nil, fmt.Errorf("unknown STT provider %q", cfg.SttProvider)
+	}
+}
+
+// withChunking оборачивает HTTP-провайдеры, у которых есть лимит на размер загружаемого файла
+func withChunking(inner Transcriber, cfg *config.Config) Transcriber {
+	return NewChunkedTranscriber(inner, cfg.SttMaxUploadBytes, cfg.SttChunkWorkers, audio.SplitOptions{
+		ChunkSeconds:   cfg.SttChunkSeconds,
+		OverlapSeconds: cfg.SttChunkOverlapSeconds,
+		SearchSeconds:  cfg.SttChunkSearchSeconds,
+	})
+}
+
+// withMetrics учитывает время распознавания файла целиком в метриках с меткой provider
+func withMetrics(provider string, inner Transcriber) Transcriber {
+	return &instrumentedTranscriber{provider: provider, inner: inner}
+}
+
+type instrumentedTranscriber struct {
+	provider string
+	inner    Transcriber
+}
+
+func (t *instrumentedTranscriber) Name() string {
+	return t.inner.Name()
+}
+
+func (t *instrumentedTranscriber) Transcribe(ctx context.Context, audioFilePath string, opts Options) (*Transcript, error) {
+	start := time.Now()
+	transcript, err := t.inner.Transcribe(ctx, audioFilePath, opts)
+	metrics.ObserveSince(metrics.STTDuration.WithLabelValues(t.provider, metrics.Result(err)), start)
+	return transcript, err
+}
@@ -0,0 +1,131 @@
+package subtitle
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"main/internal/model"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Теги WebVTT: <c>, <i>, <v Имя>, а также пословные таймкоды автоматических субтитров YouTube <00:00:01.234>
+var vttTagRe = regexp.MustCompile(`<[^>]*>`)
+
+// ParseVTT разбирает субтитры WebVTT во фрагменты с таймкодами. Автоматические субтитры YouTube
+// повторяют предыдущую строку в каждом следующем фрагменте ("бегущая строка"), такие повторы отбрасываются.
+func ParseVTT(content string) ([]model.TranscriptionSegment, error) {
+	var segments []model.TranscriptionSegment
+	var lastLine string
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var start, end float64
+	inCue := false
+	var cueLines []string
+
+	flush := func() {
+		if !inCue {
+			return
+		}
+		inCue = false
+		var fresh []string
+		for _, line := range cueLines {
+			if line == "" || line == lastLine {
+				continue
+			}
+			fresh = append(fresh, line)
+			lastLine = line
+		}
+		cueLines = nil
+		if len(fresh) == 0 {
+			return
+		}
+		segments = append(segments, model.TranscriptionSegment{
+			ID:    len(segments),
+			Start: start,
+			End:   end,
+			Text:  strings.Join(fresh, " "),
+		})
+	}
+
+	for scanner.Scan() {
+		raw := strings.TrimRight(strings.TrimPrefix(scanner.Text(), "\ufeff"), "\r")
+		line := strings.TrimSpace(raw)
+		switch {
+		case raw == "":
+			// Конец фрагмента. Строка из одних пробелов, которую YouTube ставит в автоматических
+			// субтитрах, фрагмент не завершает
+			flush()
+		case line == "":
+		case strings.Contains(line, "-->"):
+			flush()
+			var err error
+			start, end, err = parseCueTiming(line)
+			if err != nil {
+				return nil, err
+			}
+			inCue = true
+		case inCue:
+			cueLines = append(cueLines, cleanCueText(line))
+		}
+		// Строки вне фрагментов (заголовок WEBVTT, Kind:, NOTE, STYLE, номера фрагментов) пропускаем
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read vtt: %w", err)
+	}
+	flush()
+	return segments, nil
+}
+
+// Text склеивает текст фрагментов в сплошной текст
+func Text(segments []model.TranscriptionSegment) string {
+	parts := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		if text := strings.TrimSpace(segment.Text); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func cleanCueText(line string) string {
+	line = vttTagRe.ReplaceAllString(line, "")
+	return strings.Join(strings.Fields(html.UnescapeString(line)), " ")
+}
+
+// parseCueTiming разбирает строку "00:00:01.000 --> 00:00:04.000 align:start position:0%"
+func parseCueTiming(line string) (float64, float64, error) {
+	left, right, _ := strings.Cut(line, "-->")
+	fields := strings.Fields(right)
+	if len(fields) == 0 {
+		return 0, 0, fmt.Errorf("invalid vtt cue timing %q", line)
+	}
+	start, err := parseVTTTimestamp(strings.TrimSpace(left))
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseVTTTimestamp(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// parseVTTTimestamp разбирает таймкод вида hh:mm:ss.mmm или mm:ss.mmm
+func parseVTTTimestamp(value string) (float64, error) {
+	parts := strings.Split(strings.Replace(value, ",", ".", 1), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid vtt timestamp %q", value)
+	}
+	seconds := 0.0
+	for _, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid vtt timestamp %q: %w", value, err)
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds, nil
+}
@@ -0,0 +1,66 @@
+package subtitle
+
+import (
+	"main/internal/model"
+	"reflect"
+	"testing"
+)
+
+func TestParseVTT(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []model.TranscriptionSegment
+	}{
+		{
+			name: "manual subtitles",
+			content: "\ufeffWEBVTT\r\nKind: captions\r\nLanguage: ru\r\n\r\n" +
+				"1\r\n00:00:01.000 --> 00:00:04.500\r\nПривет,\r\n<i>мир</i>!\r\n\r\n" +
+				"NOTE комментарий\r\n\r\n" +
+				"2\r\n00:04.500 --> 00:06.000 align:start\r\nTom &amp; Jerry\r\n",
+			want: []model.TranscriptionSegment{
+				{ID: 0, Start: 1, End: 4.5, Text: "Привет, мир!"},
+				{ID: 1, Start: 4.5, End: 6, Text: "Tom & Jerry"},
+			},
+		},
+		{
+			name: "youtube rolling auto captions",
+			content: "WEBVTT\n\n" +
+				"00:00:00.000 --> 00:00:02.000 align:start position:0%\n \nпервая<00:00:00.500><c> строка</c>\n\n" +
+				"00:00:02.000 --> 00:00:02.010 align:start position:0%\nпервая строка\n \n\n" +
+				"00:00:02.010 --> 00:00:04.000 align:start position:0%\nпервая строка\nвторая<00:00:02.500><c> строка</c>\n",
+			want: []model.TranscriptionSegment{
+				{ID: 0, Start: 0, End: 2, Text: "первая строка"},
+				{ID: 1, Start: 2.01, End: 4, Text: "вторая строка"},
+			},
+		},
+		{
+			name:    "header only",
+			content: "WEBVTT\n\n",
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVTT(tt.content)
+			if err != nil {
+				t.Fatalf("ParseVTT() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseVTT() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVTTInvalidTiming(t *testing.T) {
+	for _, content := range []string{
+		"WEBVTT\n\n00:01.000 -->\ntext\n",
+		"WEBVTT\n\n1:2:3:4.000 --> 00:02.000\ntext\n",
+		"WEBVTT\n\n00:xx.000 --> 00:02.000\ntext\n",
+	} {
+		if _, err := ParseVTT(content); err == nil {
+			t.Errorf("ParseVTT(%q) error = nil, want error", content)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package subtitle
+
+import (
+	"fmt"
+	"main/internal/model"
+	"strings"
+)
+
+const (
+	FormatSRT = "srt"
+	FormatVTT = "vtt"
+)
+
+// Format собирает субтитры в указанном формате (srt или vtt)
+func Format(format string, segments []model.TranscriptionSegment) (string, error) {
+	switch format {
+	case FormatSRT:
+		return SRT(segments), nil
+	case FormatVTT:
+		return VTT(segments), nil
+	default:
+		return "", fmt.Errorf("unknown subtitle format %q", format)
+	}
+}
+
+// SRT формирует субтитры SubRip: нумерация с 1, таймкоды вида 00:01:02,345
+func SRT(segments []model.TranscriptionSegment) string {
+	var b strings.Builder
+	n := 0
+	for _, segment := range segments {
+		text := strings.TrimSpace(segment.Text)
+		if text == "" {
+			continue
+		}
+		n++
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", n, timestamp(segment.Start, ','), timestamp(segment.End, ','), text)
+	}
+	return b.String()
+}
+
+// VTT формирует субтитры WebVTT: заголовок WEBVTT, таймкоды вида 00:01:02.345
+func VTT(segments []model.TranscriptionSegment) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for _, segment := range segments {
+		text := strings.TrimSpace(segment.Text)
+		if text == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%s --> %s\n%s\n\n", timestamp(segment.Start, '.'), timestamp(segment.End, '.'), text)
+	}
+	return b.String()
+}
+
+func timestamp(seconds float64, msSeparator rune) string {
+	if seconds < 0 {
+		seconds = 0
+	}
+	ms := int64(seconds*1000 + 0.5)
+	h := ms / 3600000
+	m := ms / 60000 % 60
+	s := ms / 1000 % 60
+	return fmt.Sprintf("%02d:%02d:%02d%c%03d", h, m, s, msSeparator, ms%1000)
+}
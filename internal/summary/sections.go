@@ -0,0 +1,135 @@
+package summary
+
+import (
+	"fmt"
+	"main/internal/llm"
+	"main/internal/model"
+	"strings"
+)
+
+// Section часть транскрипта, которая суммаризируется отдельным запросом.
+// Start и End заполнены, только если у транскрипта были таймкоды (HasTimes).
+type Section struct {
+	Index    int
+	Title    string // название главы видео, если разделы построены по главам
+	Text     string
+	Start    float64
+	End      float64
+	HasTimes bool
+}
+
+// Label возвращает примерный таймкод раздела, например "[12:30–25:00]", или пустую строку
+func (s Section) Label() string {
+	if !s.HasTimes {
+		return ""
+	}
+	return fmt.Sprintf("[%s–%s]", FormatTimestamp(s.Start), FormatTimestamp(s.End))
+}
+
+// SplitSections делит транскрипт на разделы не больше maxTokens токенов.
+// При наличии таймкодов границы разделов проходят по границам фрагментов распознавания.
+func SplitSections(text string, segments []model.TranscriptionSegment, maxTokens int) []Section {
+	if len(segments) > 0 {
+		return splitSegments(segments, maxTokens)
+	}
+	return splitWords(text, maxTokens)
+}
+
+// SplitChapters делит транскрипт с таймкодами по главам видео. Глава длиннее maxTokens делится
+// на несколько разделов с тем же названием; главы без текста пропускаются.
+func SplitChapters(segments []model.TranscriptionSegment, chapters []model.VideoChapter, maxTokens int) []Section {
+	var sections []Section
+	for i, chapter := range chapters {
+		var chapterSegments []model.TranscriptionSegment
+		for _, segment := range segments {
+			// Последняя глава забирает все до конца, даже если длительность в метаданных неточная
+			if segment.Start >= chapter.Start && (segment.Start < chapter.End || i == len(chapters)-1) {
+				chapterSegments = append(chapterSegments, segment)
+			}
+		}
+		if len(chapterSegments) == 0 {
+			continue
+		}
+		parts := splitSegments(chapterSegments, maxTokens)
+		for k, part := range parts {
+			part.Index = len(sections)
+			part.Title = chapter.Title
+			if len(parts) > 1 {
+				part.Title = fmt.Sprintf("%s (часть %d)", chapter.Title, k+1)
+			}
+			sections = append(sections, part)
+		}
+	}
+	return sections
+}
+
+func splitSegments(segments []model.TranscriptionSegment, maxTokens int) []Section {
+	var sections []Section
+	var current []string
+	tokens := 0
+	start := segments[0].Start
+	end := segments[0].End
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		sections = append(sections, Section{
+			Index:    len(sections),
+			Text:     strings.Join(current, " "),
+			Start:    start,
+			End:      end,
+			HasTimes: true,
+		})
+		current = nil
+		tokens = 0
+	}
+
+	for _, segment := range segments {
+		text := strings.TrimSpace(segment.Text)
+		if text == "" {
+			continue
+		}
+		segmentTokens := llm.EstimateTokens(text)
+		if tokens > 0 && tokens+segmentTokens > maxTokens {
+			flush()
+		}
+		if len(current) == 0 {
+			start = segment.Start
+		}
+		current = append(current, text)
+		tokens += segmentTokens
+		end = segment.End
+	}
+	flush()
+	return sections
+}
+
+func splitWords(text string, maxTokens int) []Section {
+	var sections []Section
+	var current strings.Builder
+	for _, word := range strings.Fields(text) {
+		if current.Len() > 0 && llm.EstimateTokens(current.String()+" "+word) > maxTokens {
+			sections = append(sections, Section{Index: len(sections), Text: current.String()})
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteByte(' ')
+		}
+		current.WriteString(word)
+	}
+	if current.Len() > 0 {
+		sections = append(sections, Section{Index: len(sections), Text: current.String()})
+	}
+	return sections
+}
+
+// FormatTimestamp форматирует секунды как m:ss или h:mm:ss
+func FormatTimestamp(seconds float64) string {
+	total := int(seconds)
+	h, m, s := total/3600, total/60%60, total%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
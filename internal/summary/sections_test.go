@@ -0,0 +1,115 @@
+package summary
+
+import (
+	"main/internal/model"
+	"reflect"
+	"testing"
+)
+
+func segment(start, end float64, text string) model.TranscriptionSegment {
+	return model.TranscriptionSegment{Start: start, End: end, Text: text}
+}
+
+func TestSplitSectionsWords(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		maxTokens int
+		want      []string
+	}{
+		{"empty", "", 10, nil},
+		{"fits", "abcde fghij", 10, []string{"abcde fghij"}},
+		{"split on limit", "abcde fghij klmno", 4, []string{"abcde fghij", "klmno"}},
+		{"long word kept whole", "abcdefghijklmnopqrst uv", 2, []string{"abcdefghijklmnopqrst", "uv"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sections := SplitSections(tt.text, nil, tt.maxTokens)
+			var got []string
+			for i, section := range sections {
+				if section.Index != i || section.HasTimes {
+					t.Errorf("section %d: Index = %d, HasTimes = %v", i, section.Index, section.HasTimes)
+				}
+				got = append(got, section.Text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitSections(%q, %d) = %q, want %q", tt.text, tt.maxTokens, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitSectionsSegments(t *testing.T) {
+	segments := []model.TranscriptionSegment{
+		segment(0, 1, " abcdef "),
+		segment(1, 2, "ghijkl"),
+		segment(2, 2.5, "  "),
+		segment(2.5, 3, "mnopqr"),
+	}
+	got := SplitSections("ignored", segments, 6)
+	want := []Section{
+		{Index: 0, Text: "abcdef ghijkl", Start: 0, End: 2, HasTimes: true},
+		{Index: 1, Text: "mnopqr", Start: 2.5, End: 3, HasTimes: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitSections() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSplitChapters(t *testing.T) {
+	segments := []model.TranscriptionSegment{
+		segment(0, 1, "abcdef"),
+		segment(1, 2, "ghijkl"),
+		segment(3, 4, "mnopqr"),
+		segment(5, 6, "stuvwx"),
+		segment(9, 10, "yzabcd"),
+	}
+	chapters := []model.VideoChapter{
+		{Title: "Вступление", Start: 0, End: 2},
+		{Title: "Пустая", Start: 2, End: 3},
+		// Длительность последней главы в метаданных меньше реальной
+		{Title: "Основная часть", Start: 3, End: 6},
+	}
+
+	tests := []struct {
+		name      string
+		maxTokens int
+		want      []Section
+	}{
+		{"chapter per section", 100, []Section{
+			{Index: 0, Title: "Вступление", Text: "abcdef ghijkl", Start: 0, End: 2, HasTimes: true},
+			{Index: 1, Title: "Основная часть", Text: "mnopqr stuvwx yzabcd", Start: 3, End: 10, HasTimes: true},
+		}},
+		{"long chapter split into parts", 6, []Section{
+			{Index: 0, Title: "Вступление", Text: "abcdef ghijkl", Start: 0, End: 2, HasTimes: true},
+			{Index: 1, Title: "Основная часть (часть 1)", Text: "mnopqr stuvwx", Start: 3, End: 6, HasTimes: true},
+			{Index: 2, Title: "Основная часть (часть 2)", Text: "yzabcd", Start: 9, End: 10, HasTimes: true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitChapters(segments, chapters, tt.maxTokens)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitChapters() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	tests := []struct {
+		seconds float64
+		want    string
+	}{
+		{0, "0:00"},
+		{59.9, "0:59"},
+		{754, "12:34"},
+		{3600, "1:00:00"},
+		{3723, "1:02:03"},
+	}
+	for _, tt := range tests {
+		if got := FormatTimestamp(tt.seconds); got != tt.want {
+			t.Errorf("FormatTimestamp(%v) = %q, want %q", tt.seconds, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package summary
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"main/internal/llm"
+	"main/internal/model"
+	"main/internal/prompt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Запас токенов на инструкцию и ответ модели
+const promptReserveTokens = 1000
+
+// Описание видео в запросе обрезается: в нем часто ссылки и реклама, а не содержание
+const maxDescriptionRunes = 1500
+
+const (
+	StyleShort    = "short"
+	StyleDetailed = "detailed"
+	StyleBullets  = "bullets"
+)
+
+// Названия языков ответа в предложном падеже для подстановки в "отвечай на ... языке"
+var responseLanguages = map[string]string{
+	"ru": "русском",
+	"en": "английском",
+	"uk": "украинском",
+	"de": "немецком",
+	"fr": "французском",
+	"es": "испанском",
+}
+
+// Options параметры отдельного запроса на суммаризацию; пустые поля заменяются значениями по умолчанию
+type Options struct {
+	Model    string
+	Language string // код языка ответа, см. responseLanguages
+	Style    string // StyleShort, StyleDetailed или StyleBullets
+	Preset   string // имя пресета шаблонов запросов, см. prompt.Library
+	Title    string
+	Duration float64 // длительность в секундах, 0 - неизвестна
+	// Метаданные видео, если известны. По главам строятся разделы краткого содержания.
+	Channel     string
+	UploadDate  time.Time
+	Description string
+	Chapters    []model.VideoChapter
+}
+
+// Summarizer делает краткое содержание транскрипта. Если транскрипт не помещается в контекст модели,
+// он делится на разделы (map), каждый раздел суммаризируется отдельно, а затем результаты
+// объединяются в общее краткое содержание (reduce).
+type Summarizer struct {
+	client         *llm.Client
+	model          string
+	maxInputTokens int
+	workers        int
+	prompts        *prompt.Library
+}
+
+func NewSummarizer(client *llm.Client, modelName string, maxInputTokens, workers int, prompts *prompt.Library) *Summarizer {
+	if workers < 1 {
+		workers = 1
+	}
+	if maxInputTokens < 2*promptReserveTokens {
+		maxInputTokens = 2 * promptReserveTokens
+	}
+	return &Summarizer{
+		client:         client,
+		model:          modelName,
+		maxInputTokens: maxInputTokens,
+		workers:        workers,
+		prompts:        prompts,
+	}
+}
+
+func (s *Summarizer) Summarize(ctx context.Context, text string, segments []model.TranscriptionSegment, opts Options) (string, error) {
+	log.Printf("Requesting summary for text starting with: %.80s...", text)
+	if opts.Model == "" {
+		opts.Model = s.model
+	}
+
+	preset := s.prompts.Get(opts.Preset)
+
+	budget := s.maxInputTokens - promptReserveTokens - llm.EstimateTokens(truncateRunes(opts.Description, maxDescriptionRunes))
+	var sections []Section
+	if len(opts.Chapters) > 1 && len(segments) > 0 {
+		sections = SplitChapters(segments, opts.Chapters, budget)
+		log.Printf("Summarizing %d chapters (%d sections, preset %s)", len(opts.Chapters), len(sections), preset.Name)
+	}
+	if len(sections) == 0 {
+		if llm.EstimateTokens(text) <= budget {
+			return s.completeBlock(ctx, opts, preset, prompt.BlockSingle, promptData(text, opts))
+		}
+		sections = SplitSections(text, segments, budget)
+		log.Printf("Transcript is too long for one request, summarizing %d sections (preset %s)", len(sections), preset.Name)
+	}
+
+	summaries, err := s.summarizeSections(ctx, sections, preset, opts)
+	if err != nil {
+		return "", err
+	}
+	return s.reduce(ctx, sections, summaries, preset, opts)
+}
+
+func (s *Summarizer) summarizeSections(ctx context.Context, sections []Section, preset *prompt.Preset, opts Options) ([]string, error) {
+	summaries := make([]string, len(sections))
+	errs := make([]error, len(sections))
+	jobs := make(chan Section)
+	var wg sync.WaitGroup
+	for w := 0; w < s.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for section := range jobs {
+				data := promptData(section.Text, opts)
+				data.Part, data.Total, data.Label, data.Chapter = section.Index+1, len(sections), section.Label(), section.Title
+				summaries[section.Index], errs[section.Index] = s.completeBlock(ctx, opts, preset, prompt.BlockSection, data)
+			}
+		}()
+	}
+	for _, section := range sections {
+		jobs <- section
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("failed to summarize section %d/%d: %w", i+1, len(sections), err)
+		}
+	}
+	return summaries, nil
+}
+
+// DigestItem результат обработки одного видео плейлиста
+type DigestItem struct {
+	Title   string
+	Summary string
+}
+
+// Digest составляет общий дайджест плейлиста по результатам его видео (opts.Title - название плейлиста)
+func (s *Summarizer) Digest(ctx context.Context, items []DigestItem, opts Options) (string, error) {
+	if opts.Model == "" {
+		opts.Model = s.model
+	}
+	preset := s.prompts.Get(opts.Preset)
+	parts := make([]string, len(items))
+	for i, item := range items {
+		heading := fmt.Sprintf("Видео %d", i+1)
+		if item.Title != "" {
+			heading += " «" + item.Title + "»"
+		}
+		parts[i] = heading + "\n" + strings.TrimSpace(item.Summary)
+	}
+	log.Printf("Requesting digest for %d videos (preset %s)", len(items), preset.Name)
+	return s.reduceParts(ctx, parts, preset, opts, prompt.BlockDigestMerge, prompt.BlockDigest)
+}
+
+// reduce объединяет краткие содержания разделов
+func (s *Summarizer) reduce(ctx context.Context, sections []Section, summaries []string, preset *prompt.Preset, opts Options) (string, error) {
+	parts := make([]string, len(sections))
+	for i, section := range sections {
+		parts[i] = sectionHeading(section) + "\n" + strings.TrimSpace(summaries[i])
+	}
+	return s.reduceParts(ctx, parts, preset, opts, prompt.BlockMerge, prompt.BlockFinal)
+}
+
+// reduceParts строит итоговый ответ по частям шаблоном finalBlock. Если части не помещаются в контекст,
+// они сначала объединяются группами шаблоном mergeBlock, пока не останется одна группа.
+func (s *Summarizer) reduceParts(ctx context.Context, parts []string, preset *prompt.Preset, opts Options, mergeBlock, finalBlock string) (string, error) {
+	budget := s.maxInputTokens - promptReserveTokens
+	for {
+		groups := groupParts(parts, budget)
+		if len(groups) == len(parts) && len(parts) > 1 {
+			// Каждая часть сама по себе заполняет бюджет - объединяем попарно, чтобы цикл сходился
+			groups = pairUp(parts)
+		}
+		if len(groups) == 1 {
+			return s.completeBlock(ctx, opts, preset, finalBlock, promptData(strings.Join(groups[0], "\n\n"), opts))
+		}
+		log.Printf("Section summaries are too long, merging %d groups", len(groups))
+		merged := make([]string, len(groups))
+		for i, group := range groups {
+			result, err := s.completeBlock(ctx, opts, preset, mergeBlock, promptData(strings.Join(group, "\n\n"), opts))
+			if err != nil {
+				return "", fmt.Errorf("failed to merge summaries: %w", err)
+			}
+			merged[i] = result
+		}
+		parts = merged
+	}
+}
+
+func groupParts(parts []string, budget int) [][]string {
+	var groups [][]string
+	var current []string
+	tokens := 0
+	for _, part := range parts {
+		partTokens := llm.EstimateTokens(part)
+		if len(current) > 0 && tokens+partTokens > budget {
+			groups = append(groups, current)
+			current = nil
+			tokens = 0
+		}
+		current = append(current, part)
+		tokens += partTokens
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
+
+func pairUp(parts []string) [][]string {
+	var groups [][]string
+	for i := 0; i < len(parts); i += 2 {
+		groups = append(groups, parts[i:min(i+2, len(parts))])
+	}
+	return groups
+}
+
+func (s *Summarizer) completeBlock(ctx context.Context, opts Options, preset *prompt.Preset, block string, data prompt.Data) (string, error) {
+	text, err := preset.Render(block, data)
+	if err != nil {
+		return "", err
+	}
+	return s.client.Complete(ctx, opts.Model, []model.ChatMessage{
+		{
+			Role:    "user",
+			Content: text,
+		},
+	})
+}
+
+func sectionHeading(section Section) string {
+	heading := fmt.Sprintf("Раздел %d", section.Index+1)
+	if section.Title != "" {
+		heading += " «" + section.Title + "»"
+	}
+	if label := section.Label(); label != "" {
+		heading += " " + label
+	}
+	return heading
+}
+
+// promptData заполняет переменные шаблона запроса
+func promptData(text string, opts Options) prompt.Data {
+	data := prompt.Data{
+		Title:               opts.Title,
+		Channel:             opts.Channel,
+		Description:         truncateRunes(opts.Description, maxDescriptionRunes),
+		Language:            opts.Language,
+		LanguageInstruction: LanguageInstruction(opts.Language),
+		Style:               styleInstruction(opts.Style),
+		Transcript:          text,
+	}
+	if opts.Duration > 0 {
+		data.Duration = FormatTimestamp(opts.Duration)
+	}
+	if !opts.UploadDate.IsZero() {
+		data.UploadDate = opts.UploadDate.Format("02.01.2006")
+	}
+	return data
+}
+
+func truncateRunes(text string, limit int) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= limit {
+		return string(runes)
+	}
+	return string(runes[:limit]) + "…"
+}
+
+func styleInstruction(style string) string {
+	switch style {
+	case StyleDetailed:
+		return "подробное содержание с основными мыслями, аргументами и примерами"
+	case StyleBullets:
+		return "ключевые моменты в виде маркированного списка"
+	default:
+		return "краткое содержание в нескольких предложениях"
+	}
+}
+
+// LanguageInstruction инструкция "отвечай на ... языке" для кода языка; по умолчанию русский
+func LanguageInstruction(language string) string {
+	name, ok := responseLanguages[language]
+	if !ok {
+		name = responseLanguages["ru"]
+	}
+	return "отвечай на " + name + " языке"
+}
@@ -0,0 +1,81 @@
+package textsplit
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Разделители в порядке предпочтения: абзац, строка, конец предложения, пробел
+var separators = []string{"\n\n", "\n", ". ", "! ", "? ", "… ", "; ", ", ", " "}
+
+// Length длина текста в UTF-16 code units: так Telegram считает лимит длины сообщения
+func Length(text string) int {
+	n := 0
+	for _, r := range text {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// Split делит текст на части не длиннее limit (в единицах Length). Границы выбираются
+// по абзацам, строкам, предложениям или словам и никогда не разрезают символ UTF-8.
+func Split(text string, limit int) []string {
+	text = strings.TrimSpace(text)
+	if limit <= 0 || Length(text) <= limit {
+		if text == "" {
+			return nil
+		}
+		return []string{text}
+	}
+
+	var parts []string
+	for Length(text) > limit {
+		cut := prefixBytes(text, limit)
+		if cut == 0 {
+			// limit меньше одного символа: отдаем символ целиком, чтобы не зациклиться
+			_, cut = utf8.DecodeRuneInString(text)
+		}
+		end := breakPoint(text[:cut])
+		part := strings.TrimSpace(text[:end])
+		if part != "" {
+			parts = append(parts, part)
+		}
+		text = strings.TrimSpace(text[end:])
+	}
+	if text != "" {
+		parts = append(parts, text)
+	}
+	return parts
+}
+
+// prefixBytes длина в байтах самого длинного префикса, укладывающегося в limit
+func prefixBytes(text string, limit int) int {
+	n := 0
+	for i, r := range text {
+		size := 1
+		if r >= 0x10000 {
+			size = 2
+		}
+		if n+size > limit {
+			return i
+		}
+		n += size
+	}
+	return len(text)
+}
+
+// breakPoint ищет в префиксе последнюю подходящую границу. Граница в первой половине
+// префикса не используется, чтобы не плодить короткие сообщения; тогда режем по символу.
+func breakPoint(prefix string) int {
+	minEnd := len(prefix) / 2
+	for _, sep := range separators {
+		if i := strings.LastIndex(prefix, sep); i >= 0 && i+len(sep) > minEnd {
+			return i + len(sep)
+		}
+	}
+	return len(prefix)
+}
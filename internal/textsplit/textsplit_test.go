@@ -0,0 +1,72 @@
+package textsplit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestLength(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello", 5},
+		{"привет", 6},
+		{"😀", 2},
+		{"a😀б", 4},
+	}
+	for _, tt := range tests {
+		if got := Length(tt.text); got != tt.want {
+			t.Errorf("Length(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"empty", "   ", 10, nil},
+		{"fits", "  короткий текст ", 100, []string{"короткий текст"}},
+		{"no limit", "любой текст", 0, []string{"любой текст"}},
+		{"paragraphs", "первый абзац\n\nвторой абзац", 20, []string{"первый абзац", "второй абзац"}},
+		{"sentences", "Первое предложение. Второе предложение.", 25, []string{"Первое предложение.", "Второе предложение."}},
+		{"words", "один два три четыре", 10, []string{"один два", "три четыре"}},
+		{"early separator ignored", "а bbbbbbbbbbbb", 10, []string{"а bbbbbbbb", "bbbb"}},
+		{"no separators", "абвгдежзик", 4, []string{"абвг", "дежз", "ик"}},
+		{"surrogate pair not cut", "ab😀cd", 3, []string{"ab", "😀c", "d"}},
+		{"limit below one character", "😀😀", 1, []string{"😀", "😀"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Split(tt.text, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitKeepsTextWithinLimit(t *testing.T) {
+	text := strings.Repeat("Строка с эмодзи 😀 и словами. Еще одно предложение!\n", 40)
+	for _, limit := range []int{7, 50, 333, 4096} {
+		parts := Split(text, limit)
+		for _, part := range parts {
+			if Length(part) > limit {
+				t.Errorf("limit %d: part of length %d", limit, Length(part))
+			}
+			if !utf8.ValidString(part) {
+				t.Errorf("limit %d: invalid UTF-8 in part %q", limit, part)
+			}
+		}
+		if got, want := strings.Join(strings.Fields(strings.Join(parts, " ")), " "), strings.Join(strings.Fields(text), " "); limit >= 50 && got != want {
+			t.Errorf("limit %d: words changed after split", limit)
+		}
+	}
+}
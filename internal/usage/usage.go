@@ -0,0 +1,84 @@
+package usage
+
+import (
+	"context"
+	"log"
+	"main/internal/model"
+	"main/internal/storage"
+)
+
+type ownerKey struct{}
+
+type owner struct {
+	userID int64
+	chatID int64
+}
+
+// WithOwner помечает контекст пользователем и чатом, к которым относится расход запросов в этом контексте
+func WithOwner(ctx context.Context, userID, chatID int64) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner{userID: userID, chatID: chatID})
+}
+
+func ownerFrom(ctx context.Context) owner {
+	o, _ := ctx.Value(ownerKey{}).(owner)
+	return o
+}
+
+// Prices цены моделей по имени модели; модели без цены считаются бесплатными
+type Prices struct {
+	Prompt     map[string]float64 // за 1 млн входных токенов
+	Completion map[string]float64 // за 1 млн токенов ответа
+	Audio      map[string]float64 // за минуту распознанного аудио
+}
+
+// Cost оценка стоимости расхода по ценам
+func (p Prices) Cost(total model.UsageTotal) float64 {
+	if total.Kind == model.UsageKindSTT {
+		return total.AudioSeconds / 60 * p.Audio[total.Model]
+	}
+	return (float64(total.PromptTokens)*p.Prompt[total.Model] + float64(total.CompletionTokens)*p.Completion[total.Model]) / 1e6
+}
+
+// Tracker сохраняет расход токенов и аудио. Пользователь и чат берутся из контекста запроса (WithOwner).
+type Tracker struct {
+	repo       storage.UsageRepository
+	audioModel string
+}
+
+// NewTracker audioModel - имя модели распознавания речи, по нему берется цена аудио
+func NewTracker(repo storage.UsageRepository, audioModel string) *Tracker {
+	return &Tracker{repo: repo, audioModel: audioModel}
+}
+
+// RecordTokens сохраняет расход запроса к нейросети; подходит как llm.UsageHook
+func (t *Tracker) RecordTokens(ctx context.Context, modelName string, tokens model.TokenUsage) {
+	t.save(ctx, &model.UsageRecord{
+		Kind:             model.UsageKindLLM,
+		Model:            modelName,
+		PromptTokens:     tokens.PromptTokens,
+		CompletionTokens: tokens.CompletionTokens,
+	})
+}
+
+// RecordAudio сохраняет секунды распознанного аудио
+func (t *Tracker) RecordAudio(ctx context.Context, seconds float64) {
+	if seconds <= 0 {
+		return
+	}
+	t.save(ctx, &model.UsageRecord{
+		Kind:         model.UsageKindSTT,
+		Model:        t.audioModel,
+		AudioSeconds: seconds,
+	})
+}
+
+func (t *Tracker) save(ctx context.Context, record *model.UsageRecord) {
+	o := ownerFrom(ctx)
+	if o.userID == 0 {
+		log.Printf("Warning: %s usage of %s without user in context", record.Kind, record.Model)
+	}
+	record.UserID, record.ChatID = o.userID, o.chatID
+	if err := t.repo.SaveUsageRecord(record); err != nil {
+		log.Printf("Error saving %s usage: %v", record.Kind, err)
+	}
+}
@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Заголовок, в котором Telegram передает secret_token, указанный при setWebhook
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// Handler принимает обновления Telegram по вебхуку и отдает их в канал, как GetUpdatesChan при long polling.
+// Запросы без правильного секретного токена отклоняются.
+type Handler struct {
+	secret  string
+	updates chan tgbotapi.Update
+	stopped atomic.Bool
+}
+
+func NewHandler(secret string, buffer int) *Handler {
+	return &Handler{
+		secret:  secret,
+		updates: make(chan tgbotapi.Update, buffer),
+	}
+}
+
+func (h *Handler) Updates() tgbotapi.UpdatesChannel {
+	return h.updates
+}
+
+// Stop перестает принимать обновления: HTTP-сервер продолжает работать (например, для /metrics),
+// а Telegram получает 503 и повторит доставку после перезапуска бота
+func (h *Handler) Stop() {
+	h.stopped.Store(true)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.stopped.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := r.Header.Get(secretTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.secret)) != 1 {
+		log.Printf("Webhook: rejected request from %s with invalid secret token", r.RemoteAddr)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		log.Printf("Webhook: failed to decode update: %v", err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case h.updates <- update:
+		w.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		// Telegram повторит доставку обновления, если не получит 200
+		http.Error(w, "timeout", http.StatusServiceUnavailable)
+	}
+}
+
+// Register регистрирует вебхук в Telegram. В v5.5.1 WebhookConfig не поддерживает secret_token,
+// поэтому запрос setWebhook собирается вручную.
+func Register(bot *tgbotapi.BotAPI, url, secret string) error {
+	params := tgbotapi.Params{
+		"url":          url,
+		"secret_token": secret,
+	}
+	if err := params.AddInterface("allowed_updates", []string{"message", "callback_query"}); err != nil {
+		return fmt.Errorf("failed to encode allowed_updates: %w", err)
+	}
+
+	resp, err := bot.MakeRequest("setWebhook", params)
+	if err != nil {
+		return fmt.Errorf("setWebhook failed: %w", err)
+	}
+	if !resp.Ok {
+		return fmt.Errorf("setWebhook failed: %s", resp.Description)
+	}
+	return nil
+}